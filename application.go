@@ -1,18 +1,18 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/logging"
 	"github.com/go-qiu/passer-auth-service/middlewares"
 )
 
-// serverError will log server side errors and send a HTTP Internal Server Error to the requestor.
-func (a *application) serverError(w http.ResponseWriter, err error) {
+// serverError will log server side errors, with the fields of the request, r, and send a HTTP Internal Server Error to the requestor.
+func (a *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	// log the error on the server side
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	a.errorLog.Println(trace)
+	logging.FromContext(r.Context()).Error("[Server]: internal server error", logging.FieldError, err, "stack", string(debug.Stack()))
 
 	// send an http error response to the requestor.
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -35,9 +35,45 @@ func (a *application) routes() *http.ServeMux {
 	// recommended to declare a custom server mux, for use in instantiating a http server, in production.
 	mux := http.NewServeMux()
 
+	// requests to the secured api endpoints must carry a valid JWT or API key.
+	authenticate := middlewares.Authenticate(a.config, a.apiKeys.Keys, a.dataStore, a.roles, a.orgs, a.impersonation, a.delegations, a.sessions)
+
 	// fixed path patterns
 	mux.HandleFunc("/auth", a.Auth)
-	mux.Handle("/users", middlewares.ValidateJWT(http.HandlerFunc(a.Users)))
-	mux.Handle("/verify", middlewares.ValidateJWT(http.HandlerFunc(a.Verify)))
+	mux.Handle("/auth/logout", authenticate(http.HandlerFunc(a.sessions.Logout)))
+	mux.HandleFunc("/auth/password/forgot", a.ForgotPassword)
+	mux.HandleFunc("/auth/password/reset", a.ResetPassword)
+	mux.HandleFunc("/signup", a.registration.SignUp)
+	mux.HandleFunc("/signup/verify", a.registration.Verify)
+	mux.HandleFunc("/oauth/authorize", a.oauth.Authorize)
+	mux.HandleFunc("/oauth/token", a.oauth.Token)
+	mux.HandleFunc("/oauth/device_authorization", a.oauth.DeviceAuthorization)
+	mux.HandleFunc("/oauth/device", a.oauth.Device)
+	mux.HandleFunc("/oauth/introspect", a.oauth.Introspect)
+	mux.HandleFunc("/.well-known/openid-configuration", a.oauth.Discovery)
+	mux.HandleFunc("/.well-known/jwks.json", a.oauth.JWKS)
+	mux.Handle("/userinfo", authenticate(http.HandlerFunc(a.oauth.UserInfo)))
+	mux.Handle("/users", authenticate(middlewares.RequireScope("users:read", "users:write", middlewares.RequirePermission(models.PermUsersRead, models.PermUsersWrite, http.HandlerFunc(a.Users)))))
+	mux.Handle("/users/me/api-keys", authenticate(http.HandlerFunc(a.apiKeys.Handler)))
+	mux.Handle("/users/me/api-keys/", authenticate(http.HandlerFunc(a.apiKeys.Handler)))
+	mux.Handle("/users/me/delegations", authenticate(http.HandlerFunc(a.delegations.Handler)))
+	mux.Handle("/users/me/delegations/", authenticate(http.HandlerFunc(a.delegations.Handler)))
+	mux.Handle("/pickups/codes", authenticate(http.HandlerFunc(a.PickupCode)))
+	mux.HandleFunc("/pickups/key", a.PickupKey)
+	mux.Handle("/users/me/sessions", authenticate(http.HandlerFunc(a.sessions.Handler)))
+	mux.Handle("/users/me/sessions/", authenticate(http.HandlerFunc(a.sessions.Handler)))
+	mux.Handle("/admin/users/", authenticate(middlewares.RequirePermission(models.PermUsersRead, models.PermUsersWrite, http.HandlerFunc(a.sessions.Admin))))
+	mux.Handle("/verify", authenticate(http.HandlerFunc(a.Verify)))
+	mux.Handle("/admin/impersonations", authenticate(http.HandlerFunc(a.impersonation.Handler)))
+	mux.Handle("/admin/impersonations/", authenticate(http.HandlerFunc(a.impersonation.Handler)))
+	mux.Handle("/admin/roles", authenticate(middlewares.RequirePermission(models.PermRolesRead, models.PermRolesWrite, http.HandlerFunc(a.adminRoles.Handler))))
+	mux.Handle("/admin/roles/", authenticate(middlewares.RequirePermission(models.PermRolesRead, models.PermRolesWrite, http.HandlerFunc(a.adminRoles.Handler))))
+	mux.Handle("/admin/orgs", authenticate(middlewares.RequirePermission(models.PermOrgsRead, models.PermOrgsWrite, http.HandlerFunc(a.organizations.Admin))))
+	mux.Handle("/admin/orgs/", authenticate(middlewares.RequirePermission(models.PermOrgsRead, models.PermOrgsWrite, http.HandlerFunc(a.organizations.Admin))))
+	mux.Handle("/orgs/me", authenticate(http.HandlerFunc(a.organizations.Mine)))
+	mux.Handle("/orgs/me/users", authenticate(middlewares.RequirePermission(models.PermMembersRead, models.PermMembersWrite, http.HandlerFunc(a.organizations.Members))))
+	mux.Handle("/orgs/me/users/", authenticate(middlewares.RequirePermission(models.PermMembersRead, models.PermMembersWrite, http.HandlerFunc(a.organizations.Members))))
+	mux.Handle("/authz/forward", a.forward.Handler(authenticate))
+	mux.Handle("/admin/permissions", authenticate(middlewares.RequirePermission(models.PermRolesRead, models.PermRolesWrite, http.HandlerFunc(a.adminRoles.Permissions))))
 	return mux
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/config"
+	"github.com/go-qiu/passer-auth-service/helpers"
+)
+
+var preloadOnce sync.Once
+
+// routedApp returns the routes of a web application built as the server builds it, on new stores and the preloaded users.
+func routedApp(t *testing.T) http.Handler {
+	t.Helper()
+
+	preloadOnce.Do(func() {
+		userList, err := helpers.Preload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range userList {
+			ds.InsertNode(u, u.Email)
+		}
+	})
+
+	st, err := newStores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		JWTSecretKey:          strings.Repeat("k", config.MinSecretKeyLength),
+		JWTIssuer:             "passer",
+		JWTExp:                time.Hour,
+		ResetTokenTTL:         30 * time.Minute,
+		ImpersonationTTL:      time.Hour,
+		DelegationTokenTTL:    time.Hour,
+		DelegationMaxValidity: 24 * time.Hour,
+		CookieSameSite:        http.SameSiteStrictMode,
+	}
+	a, err := newApplication(cfg, st, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.routes()
+}
+
+// serve serves the request of the method, to the path, with the authorization, if any, and the JSON body, if any.
+func serve(h http.Handler, method string, path string, authorization string, body string) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	return rr
+}
+
+// decodeData decodes the data of the JSON response, {ok, msg, data}, into v.
+func decodeData(t *testing.T, rr *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	var res struct {
+		Data json.RawMessage `json:"data"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &res)
+	if err == nil {
+		err = json.Unmarshal(res.Data, v)
+	}
+	if err != nil {
+		t.Fatalf("fail to decode the response (%d) %s: %v", rr.Code, rr.Body.String(), err)
+	}
+}
+
+// signIn returns the JWT of the user, from '/auth'.
+func signIn(t *testing.T, h http.Handler, email string, pw string) string {
+	t.Helper()
+
+	rr := serve(h, http.MethodPost, "/auth", "", `{"email":"`+email+`","pw":"`+pw+`"}`)
+	var data struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, rr, &data)
+	if data.Token == "" {
+		t.Fatalf("%s is not signed in (%d): %s", email, rr.Code, rr.Body.String())
+	}
+
+	return data.Token
+}
+
+// createAPIKey returns a new API key of the user of the token, limited to the scopes.
+func createAPIKey(t *testing.T, h http.Handler, token string, scopes string) string {
+	t.Helper()
+
+	rr := serve(h, http.MethodPost, "/users/me/api-keys", "Bearer "+token, `{"name":"test","scopes":[`+scopes+`]}`)
+	var data struct {
+		Key string `json:"key"`
+	}
+	decodeData(t, rr, &data)
+	if data.Key == "" {
+		t.Fatalf("no api key created (%d): %s", rr.Code, rr.Body.String())
+	}
+
+	return data.Key
+}
+
+// TestRequirePermissionScopes checks that the permission routes honour the scopes of an API key,
+// which carries all the permissions of its user.
+func TestRequirePermissionScopes(t *testing.T) {
+
+	h := routedApp(t)
+	token := signIn(t, h, "admin@passer.com", "pA22er.54321")
+	key := createAPIKey(t, h, token, `"parcels:collect"`)
+	usersKey := createAPIKey(t, h, token, `"users:read"`)
+
+	tests := []struct {
+		name       string
+		credential string
+		path       string
+		wantStatus int
+	}{
+		{name: "admin token on the roles", credential: token, path: "/admin/roles", wantStatus: http.StatusOK},
+		{name: "scoped key on the roles", credential: key, path: "/admin/roles", wantStatus: http.StatusForbidden},
+		{name: "scoped key on the permissions", credential: key, path: "/admin/permissions", wantStatus: http.StatusForbidden},
+		{name: "scoped key on the organizations", credential: key, path: "/admin/orgs", wantStatus: http.StatusForbidden},
+		{name: "scoped key on the users", credential: key, path: "/users", wantStatus: http.StatusForbidden},
+		{name: "key scoped to the users", credential: usersKey, path: "/users", wantStatus: http.StatusOK},
+		{name: "key scoped to the users on the roles", credential: usersKey, path: "/admin/roles", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(h, http.MethodGet, tt.path, "Bearer "+tt.credential, "")
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestSessionsOwnTokenOnly checks that the sessions of a user are only managed with the user's own token.
+func TestSessionsOwnTokenOnly(t *testing.T) {
+
+	h := routedApp(t)
+	token := signIn(t, h, "admin@passer.com", "pA22er.54321")
+	key := createAPIKey(t, h, token, `"users:read"`)
+
+	rr := serve(h, http.MethodGet, "/users/me/sessions", "Bearer "+token, "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("own token: want %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		rr = serve(h, method, "/users/me/sessions/any", "Bearer "+key, "")
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s with an api key: want %d, got %d: %s", method, http.StatusForbidden, rr.Code, rr.Body.String())
+		}
+	}
+}
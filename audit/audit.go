@@ -0,0 +1,300 @@
+/*
+Package audit records the security events of the service (e.g. the logins, the creation and deletion of users)
+in an append-only file of JSON lines, the audit log.
+
+Each entry holds the hash of the previous entry and its own hash, computed over its content and the previous hash,
+so the entries form a chain: altering, inserting or removing an entry breaks the chain from that entry on.
+Verify checks the chain of an audit log, e.g. with 'passer-auth-service verify-audit <file>'.
+A chain cannot reveal the removal of its last entries, so the audit log should be shipped to another system too.
+*/
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// the actions recorded.
+const (
+	ActionLogin                = "auth.login"
+	ActionLogout               = "auth.logout"
+	ActionToken                = "auth.token"
+	ActionPasswordResetRequest = "auth.password_reset_request"
+	ActionPasswordReset        = "auth.password_reset"
+	ActionSignUp               = "user.signup"
+	ActionVerifyEmail          = "user.verify_email"
+	ActionUserCreate           = "user.create"
+	ActionUserUpdate           = "user.update"
+	ActionUserDelete           = "user.delete"
+	ActionImpersonationStart   = "impersonation.start"
+	ActionImpersonationEnd     = "impersonation.end"
+	ActionAPIKeyCreate         = "api_key.create"
+	ActionAPIKeyRevoke         = "api_key.revoke"
+	ActionDelegationCreate     = "delegation.create"
+	ActionDelegationRevoke     = "delegation.revoke"
+	ActionSessionRevoke        = "session.revoke"
+	ActionRoleCreate           = "role.create"
+	ActionRoleUpdate           = "role.update"
+	ActionRoleDelete           = "role.delete"
+	ActionOrgCreate            = "org.create"
+	ActionMemberCreate         = "org.member_create"
+	ActionMemberUpdate         = "org.member_update"
+	ActionMemberDelete         = "org.member_delete"
+)
+
+// the outcomes of the actions.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// ActorSystem is the actor of the actions of the service itself, e.g. the expiry of an impersonation session.
+const ActorSystem = "system"
+
+// Event is a security event, as recorded by the caller.
+type Event struct {
+	// the user (id, or email when not authenticated yet) or client doing the action.
+	Actor  string
+	Action string
+	// what the action is done on, e.g. the id of a user.
+	Target  string
+	Outcome string
+	// the ip address the request came from, and the id of the request (see middlewares.RequestID).
+	IP        string
+	RequestID string
+}
+
+// Entry is an entry of the audit log, i.e. an event with its place in the chain.
+type Entry struct {
+	Seq       int64  `json:"seq"`
+	Time      string `json:"time"`
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Target    string `json:"target,omitempty"`
+	Outcome   string `json:"outcome"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	PrevHash  string `json:"prevHash"`
+	Hash      string `json:"hash"`
+}
+
+// ErrBrokenChain is returned when an entry of the audit log does not chain to the previous one.
+var ErrBrokenChain = errors.New("[Audit]: the chain of the audit log is broken")
+
+// computeHash returns the hash of the entry, i.e. the hex encoded SHA256 hash of the entry without its hash, in JSON.
+// The previous hash is part of the entry, so the hash covers the whole chain up to the entry.
+func computeHash(e Entry) (string, error) {
+
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log is an audit log, appended to a file.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  int64
+	prev string
+
+	// the size of the file up to the end of the last entry recorded, which a failed write is truncated back to.
+	size int64
+	// set once a failed write could not be undone, so no entry is chained after the partial one.
+	broken error
+}
+
+// Open opens the audit log in the file at path, creating it when it does not exist.
+// The existing entries are verified, so an audit log with a broken chain is not appended to.
+func Open(path string) (*Log, error) {
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("[Audit]: fail to open the audit log: %w", err)
+	}
+
+	last, err := Verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("[Audit]: %s: %w", path, err)
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("[Audit]: fail to open the audit log: %w", err)
+	}
+
+	return &Log{file: f, seq: last.Seq, prev: last.Hash, size: size}, nil
+}
+
+// Record appends the event to the audit log. The entry is synced to the disk before Record returns.
+func (l *Log) Record(ev Event) error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.broken != nil {
+		return l.broken
+	}
+
+	e := Entry{
+		Seq:       l.seq + 1,
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Actor:     ev.Actor,
+		Action:    ev.Action,
+		Target:    ev.Target,
+		Outcome:   ev.Outcome,
+		IP:        ev.IP,
+		RequestID: ev.RequestID,
+		PrevHash:  l.prev,
+	}
+
+	var err error
+	e.Hash, err = computeHash(e)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// a failed write (or sync) is truncated back to the last entry, so no partial entry is followed by others.
+	b = append(b, '\n')
+	_, err = l.file.Write(b)
+	if err != nil {
+		return l.undo(fmt.Errorf("[Audit]: fail to write the audit log: %w", err))
+	}
+	err = l.file.Sync()
+	if err != nil {
+		return l.undo(fmt.Errorf("[Audit]: fail to sync the audit log: %w", err))
+	}
+
+	l.seq = e.Seq
+	l.prev = e.Hash
+	l.size += int64(len(b))
+	return nil
+}
+
+// undo truncates the file back to the end of the last entry recorded, after the failed write, err, of an entry.
+// When the file cannot be truncated, the audit log is broken: no more entries are recorded, and it fails to be opened
+// (see Open) until the partial entry is removed by hand. It returns err, with the failure to truncate, if any.
+func (l *Log) undo(err error) error {
+
+	terr := l.file.Truncate(l.size)
+	if terr != nil {
+		l.broken = fmt.Errorf("[Audit]: the audit log ends with a partial entry, which fails to be removed: %w", terr)
+		return fmt.Errorf("%w; %v", err, l.broken)
+	}
+
+	return err
+}
+
+// Flush syncs the audit log to the disk (see data.Flusher).
+func (l *Log) Flush() error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Sync()
+}
+
+// Verify reads the entries of the audit log, r, and checks their chain. It returns the last entry (the zero entry for an empty audit log),
+// or an error, wrapping ErrBrokenChain, naming the first entry that was altered, inserted or removed.
+func Verify(r io.Reader) (Entry, error) {
+
+	var last Entry
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+
+		var e Entry
+		err := json.Unmarshal(sc.Bytes(), &e)
+		if err != nil {
+			return last, fmt.Errorf("%w: line %d is not an entry: %s", ErrBrokenChain, line, err)
+		}
+
+		if e.Seq != last.Seq+1 || e.PrevHash != last.Hash {
+			return last, fmt.Errorf("%w: line %d (seq %d) does not follow the entry seq %d", ErrBrokenChain, line, e.Seq, last.Seq)
+		}
+
+		hash, err := computeHash(e)
+		if err != nil {
+			return last, err
+		}
+		if hash != e.Hash {
+			return last, fmt.Errorf("%w: line %d (seq %d) has been altered", ErrBrokenChain, line, e.Seq)
+		}
+
+		last = e
+	}
+
+	err := sc.Err()
+	if err != nil {
+		return last, fmt.Errorf("[Audit]: fail to read the audit log: %w", err)
+	}
+
+	return last, nil
+}
+
+// VerifyFile checks the chain of the audit log in the file at path (see Verify).
+func VerifyFile(path string) (Entry, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Entry{}, fmt.Errorf("[Audit]: fail to open the audit log: %w", err)
+	}
+	defer f.Close()
+
+	return Verify(f)
+}
+
+// the audit log of the service, if any (see SetDefault).
+var (
+	defaultMu  sync.RWMutex
+	defaultLog *Log
+)
+
+// SetDefault sets the audit log the events are recorded in by Record.
+func SetDefault(l *Log) {
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultLog = l
+}
+
+// Record records the event in the audit log of the service. It does nothing when none is set (see SetDefault).
+// A failure to record is logged, as the operation audited has already been done.
+func Record(ev Event) {
+
+	defaultMu.RLock()
+	l := defaultLog
+	defaultMu.RUnlock()
+
+	if l == nil {
+		return
+	}
+
+	err := l.Record(ev)
+	if err != nil {
+		slog.Error("[Audit]: fail to record an event", "action", ev.Action, "outcome", ev.Outcome, "err", err)
+	}
+}
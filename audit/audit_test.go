@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLog records n events in a new audit log, and returns the path of its file and its lines.
+func writeLog(t *testing.T, n int) (string, [][]byte) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err = l.Record(Event{Actor: "u-admin", Action: ActionLogin, Target: "u-admin", Outcome: OutcomeSuccess, IP: "10.0.0.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.file.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path, bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+}
+
+// TestRecordVerify checks that the entries recorded chain, also across the openings of the audit log.
+func TestRecordVerify(t *testing.T) {
+
+	path, lines := writeLog(t, 3)
+	if len(lines) != 3 {
+		t.Fatalf("want 3 lines, got %d", len(lines))
+	}
+
+	last, err := VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Seq != 3 {
+		t.Errorf("want the last entry seq 3, got %d", last.Seq)
+	}
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Record(Event{Actor: "u-admin", Action: ActionLogout, Outcome: OutcomeSuccess})
+	l.file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last, err = VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Seq != 4 || last.Action != ActionLogout {
+		t.Errorf("want the last entry seq 4 (%s), got %d (%s)", ActionLogout, last.Seq, last.Action)
+	}
+
+	last, err = Verify(strings.NewReader(""))
+	if err != nil || last.Seq != 0 {
+		t.Errorf("empty audit log: want seq 0 and no error, got %d, %v", last.Seq, err)
+	}
+}
+
+// TestVerifyBrokenChain checks that altering, removing, reordering or inserting an entry breaks the chain at its line,
+// and that an audit log with a broken chain is not opened.
+func TestVerifyBrokenChain(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		alter    func(lines [][]byte) [][]byte
+		wantLine string
+		wantSeq  int64
+	}{
+		{
+			name: "edited",
+			alter: func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte(`"actor":"u-admin"`), []byte(`"actor":"u-other"`), 1)
+				return lines
+			},
+			wantLine: "line 2 ",
+			wantSeq:  1,
+		},
+		{
+			name: "deleted",
+			alter: func(lines [][]byte) [][]byte {
+				return append(lines[:1:1], lines[2:]...)
+			},
+			wantLine: "line 2 ",
+			wantSeq:  1,
+		},
+		{
+			name: "reordered",
+			alter: func(lines [][]byte) [][]byte {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantLine: "line 2 ",
+			wantSeq:  1,
+		},
+		{
+			name: "inserted",
+			alter: func(lines [][]byte) [][]byte {
+				return append(lines[:3:3], append([][]byte{lines[0]}, lines[3:]...)...)
+			},
+			wantLine: "line 4 ",
+			wantSeq:  3,
+		},
+		{
+			name: "not an entry",
+			alter: func(lines [][]byte) [][]byte {
+				lines[2] = lines[2][:len(lines[2])/2]
+				return lines
+			},
+			wantLine: "line 3 ",
+			wantSeq:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			path, lines := writeLog(t, 4)
+			err := os.WriteFile(path, append(bytes.Join(tt.alter(lines), []byte("\n")), '\n'), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			last, err := VerifyFile(path)
+			if !errors.Is(err, ErrBrokenChain) {
+				t.Fatalf("want %v, got %v", ErrBrokenChain, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantLine) {
+				t.Errorf("want the error at %q, got %v", tt.wantLine, err)
+			}
+			if last.Seq != tt.wantSeq {
+				t.Errorf("want the last entry verified seq %d, got %d", tt.wantSeq, last.Seq)
+			}
+
+			l, err := Open(path)
+			if !errors.Is(err, ErrBrokenChain) {
+				t.Errorf("open: want %v, got %v", ErrBrokenChain, err)
+			}
+			if l != nil {
+				l.file.Close()
+				t.Error("open: an audit log with a broken chain is opened")
+			}
+		})
+	}
+}
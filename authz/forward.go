@@ -0,0 +1,115 @@
+package authz
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/tracing"
+)
+
+// the headers of the identity of the user of an allowed request, and of the party acting on the user's behalf (the 'act' of
+// a delegated or impersonation token), if any, for the proxy to pass on to the upstream service.
+const (
+	UserIdHeader    = "X-User-Id"
+	UserRolesHeader = "X-User-Roles"
+	ActorIdHeader   = "X-Actor-Id"
+)
+
+// MethodHeaders and URIHeaders are the headers of the method and URI of the request forwarded by the proxy,
+// i.e. the headers of Traefik ForwardAuth, then the headers conventionally set for nginx auth_request.
+var (
+	MethodHeaders = []string{"X-Forwarded-Method", "X-Original-Method"}
+	URIHeaders    = []string{"X-Forwarded-Uri", "X-Original-URI"}
+)
+
+// Forward answers the forward-auth requests of the reverse proxies, with the rules of the forwarded requests.
+type Forward struct {
+	Rules Rules
+}
+
+// Handler returns the handler of '/authz/forward'. The credentials of the requests are verified by authenticate (see middlewares.Authenticate),
+// as if they were sent with the forwarded method, so a state-changing request with the session cookie must still carry the CSRF token.
+// A JWT is verified by its signature, then checked against the revocations (see middlewares.Revoker): a session JWT is looked up
+// in the session store, where its last use is recorded, and a delegated or impersonation JWT in its own store.
+func (f *Forward) Handler(authenticate func(http.Handler) http.Handler) http.Handler {
+
+	authorize := authenticate(http.HandlerFunc(f.authorize))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// the proxies may not send the forward-auth request with the method of the forwarded request, which is then only known from its header.
+		fr := r.WithContext(r.Context())
+		if method := firstHeader(r, MethodHeaders); method != "" {
+			fr.Method = strings.ToUpper(method)
+		}
+
+		authorize.ServeHTTP(&challenger{ResponseWriter: w}, fr)
+	})
+}
+
+// authorize answers an authenticated forward-auth request, with the rule of the forwarded request.
+func (f *Forward) authorize(w http.ResponseWriter, r *http.Request) {
+
+	if c, ok := w.(*challenger); ok {
+		c.authenticated = true
+	}
+
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	span := tracing.SpanFromContext(r.Context())
+
+	if f.Rules != nil {
+		uri := firstHeader(r, URIHeaders)
+		rule, ok := f.Rules.Match(r.Method, uri)
+		if !ok || !rule.Allows(pl) {
+			metrics.ForwardAuthDecisions.Inc(metrics.ForwardForbidden)
+			span.SetAttribute("authz.decision", metrics.ForwardForbidden)
+			logging.FromContext(r.Context()).Debug("[Authz]: forwarded request denied", "forwarded_method", r.Method, "rule", rule.Path)
+			helpers.WriteJSON(w, http.StatusForbidden, false, "[Authz]: not allowed to access this resource", nil)
+			return
+		}
+	}
+
+	metrics.ForwardAuthDecisions.Inc(metrics.ForwardAllowed)
+	span.SetAttribute("authz.decision", metrics.ForwardAllowed)
+	w.Header().Set(UserIdHeader, pl.Subject())
+	w.Header().Set(UserRolesHeader, strings.Join(pl.Roles, ","))
+	if pl.Act != nil {
+		w.Header().Set(ActorIdHeader, pl.Act.Sub)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// challenger turns the 403 of a request that failed its authentication into a 401 with a Bearer challenge,
+// as the proxies only redirect to the login page (or pass on the response) on a 401.
+type challenger struct {
+	http.ResponseWriter
+	authenticated bool
+}
+
+// WriteHeader writes the status code, 401 in place of the 403 of a failed authentication.
+func (c *challenger) WriteHeader(status int) {
+
+	if !c.authenticated && status == http.StatusForbidden {
+		metrics.ForwardAuthDecisions.Inc(metrics.ForwardUnauthenticated)
+		c.Header().Set("WWW-Authenticate", `Bearer realm="passer"`)
+		status = http.StatusUnauthorized
+	}
+
+	c.ResponseWriter.WriteHeader(status)
+}
+
+// firstHeader returns the value of the first of the headers set on the request.
+func firstHeader(r *http.Request, headers []string) string {
+
+	for _, h := range headers {
+		if v := strings.TrimSpace(r.Header.Get(h)); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,162 @@
+/*
+Package authz implements the forward-auth endpoint of the service, '/authz/forward', so the other PASSER services
+can be protected at the edge by their reverse proxy (nginx auth_request, Traefik ForwardAuth), without each validating the tokens.
+
+The proxy asks the service about every request it receives, forwarding its credentials (the 'Authorization', 'X-API-Key'
+or session cookie) and its method and URI (see MethodHeaders and URIHeaders). The service answers:
+  - 200, with the identity of the user in the headers 'X-User-Id' and 'X-User-Roles', and of the party acting on the user's
+    behalf, if any, in 'X-Actor-Id', when the request is allowed;
+  - 401, when the request carries no valid credential;
+  - 403, when the token does not grant the permissions, or the user does not hold any of the roles, the rules require
+    for the method and URI (see Rule.Allows).
+
+The rules are read from a JSON file (see ParseRules), e.g.
+
+	[
+	  {"path": "/parcels/", "permissions": ["parcels:read"]},
+	  {"path": "/parcels/", "methods": ["DELETE"], "roles": ["ADMIN"]},
+	  {"path": "/lockers/status"}
+	]
+
+The permissions are preferred to the roles: they are bound by the scopes of the tokens issued to a client (e.g. an API key),
+while the roles are only honoured for the users' own tokens.
+
+Without rules, any authenticated request is allowed.
+*/
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// ErrInvalidRules is returned when the rules cannot be parsed.
+var ErrInvalidRules = errors.New("[Authz]: invalid forward-auth rules")
+
+// Rule is the permissions and roles required for the requests to a path, with one of the methods.
+type Rule struct {
+	// the path of the requests: a path ending with '/' matches all the paths under it (like http.ServeMux), any other path only itself.
+	Path string `json:"path"`
+	// the methods of the requests, all methods when empty.
+	Methods []string `json:"methods,omitempty"`
+	// the permissions required, all of them.
+	Permissions []string `json:"permissions,omitempty"`
+	// the roles allowed, any one of them is enough.
+	// any authenticated user is allowed when both the permissions and the roles are empty.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// matches checks if the rule applies to the request with the method, to the (clean) path, p.
+func (rule Rule) matches(method string, p string) bool {
+
+	if strings.HasSuffix(rule.Path, "/") {
+		if !strings.HasPrefix(p, rule.Path) && p != strings.TrimSuffix(rule.Path, "/") {
+			return false
+		}
+	} else if p != rule.Path {
+		return false
+	}
+
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, m := range rule.Methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows checks if the token, pl, is allowed by the rule: it must grant all the permissions of the rule (see middlewares.Granted),
+// and its user must hold one of the roles of the rule, if any.
+// The roles are the user's, whatever the token was limited to, so a rule with roles refuses the tokens issued to a client
+// (an OAuth 2.0 client, an API key, a delegation) and the tokens of a party acting on the user's behalf (e.g. an impersonation).
+func (rule Rule) Allows(pl jwt.JWTPayload) bool {
+
+	for _, perm := range rule.Permissions {
+		if !middlewares.Granted(pl, perm) {
+			return false
+		}
+	}
+
+	if len(rule.Roles) == 0 {
+		return true
+	}
+	if pl.ClientId != "" || pl.Act != nil {
+		return false
+	}
+	for _, required := range rule.Roles {
+		if pl.HasRole(required) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rules are the rules of the forward-auth endpoint, the most specific first (see Match).
+type Rules []Rule
+
+// ParseRules parses the rules, a JSON array of rules.
+// The rules are sorted once, the longest path first, so matching a request does not depend on the order of the file.
+func ParseRules(b []byte) (Rules, error) {
+
+	var rules Rules
+	err := json.Unmarshal(b, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRules, err)
+	}
+
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("%w: the path of rule %d must start with '/'", ErrInvalidRules, i+1)
+		}
+		for j, m := range rule.Methods {
+			rules[i].Methods[j] = strings.ToUpper(strings.TrimSpace(m))
+		}
+	}
+
+	// the rules restricted to some methods come before the rules, of the same path, for all methods.
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].Path) != len(rules[j].Path) {
+			return len(rules[i].Path) > len(rules[j].Path)
+		}
+		return len(rules[i].Methods) > 0 && len(rules[j].Methods) == 0
+	})
+
+	return rules, nil
+}
+
+// Match returns the rule of the request with the method, to the uri (its path, with the query if any), i.e. the rule of the longest path matching it.
+// The path is cleaned first, so '/public/../admin' is matched as '/admin'.
+func (rules Rules) Match(method string, uri string) (Rule, bool) {
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return Rule{}, false
+	}
+	p := path.Clean(u.Path)
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	for _, rule := range rules {
+		if rule.matches(method, p) {
+			return rule, true
+		}
+	}
+
+	return Rule{}, false
+}
@@ -0,0 +1,67 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// TestAllows checks that the permissions of a rule are bound by the scopes of the token, and that the roles are only
+// honoured for the users' own tokens.
+func TestAllows(t *testing.T) {
+
+	adminPerms := []string{"users:read", "users:write", "parcels:read", "parcels:collect"}
+	admin := jwt.JWTPayload{Id: "admin@passer.com", Sub: "u-admin", Roles: []string{"ADMIN"}, Perms: adminPerms}
+
+	apiKey := admin
+	apiKey.ClientId = middlewares.APIKeyClientId
+	apiKey.Scope = "parcels:collect"
+
+	thirdParty := admin
+	thirdParty.ClientId = "merchant-portal"
+	thirdParty.Scope = "parcels:read"
+
+	delegated := jwt.JWTPayload{Sub: "u-consumer", Perms: []string{"parcels:read"}, ClientId: "delegation", Scope: "parcels:read", Act: &jwt.Actor{Sub: "u-agent"}}
+
+	impersonated := jwt.JWTPayload{Sub: "u-consumer", Roles: []string{"CONSUMER"}, Perms: []string{"parcels:read"}, Act: &jwt.Actor{Sub: "u-admin"}}
+
+	machine := jwt.JWTPayload{Sub: "locker-station-01", ClientId: "locker-station-01", Scope: "parcels:collect"}
+
+	adminRule := Rule{Path: "/admin/", Roles: []string{"ADMIN"}}
+	collectRule := Rule{Path: "/parcels/", Permissions: []string{"parcels:collect"}}
+	readRule := Rule{Path: "/parcels/", Permissions: []string{"parcels:read"}}
+	bothRule := Rule{Path: "/users/", Permissions: []string{"users:read", "users:write"}}
+	openRule := Rule{Path: "/lockers/status"}
+
+	tests := []struct {
+		name string
+		rule Rule
+		pl   jwt.JWTPayload
+		want bool
+	}{
+		{name: "open rule", rule: openRule, pl: apiKey, want: true},
+		{name: "role of the user's own token", rule: adminRule, pl: admin, want: true},
+		{name: "role of an api key", rule: adminRule, pl: apiKey},
+		{name: "role of a third-party token", rule: adminRule, pl: thirdParty},
+		{name: "role of an impersonation token", rule: Rule{Path: "/parcels/", Roles: []string{"CONSUMER"}}, pl: impersonated},
+		{name: "permission of the user's own token", rule: bothRule, pl: admin, want: true},
+		{name: "permission within the scopes of an api key", rule: collectRule, pl: apiKey, want: true},
+		{name: "permission out of the scopes of an api key", rule: readRule, pl: apiKey},
+		{name: "permission out of the scopes of a third-party token", rule: bothRule, pl: thirdParty},
+		{name: "permission within the scopes of a third-party token", rule: readRule, pl: thirdParty, want: true},
+		{name: "permission of a delegated token", rule: readRule, pl: delegated, want: true},
+		{name: "permission not delegated", rule: collectRule, pl: delegated},
+		{name: "scope of a client", rule: collectRule, pl: machine, want: true},
+		{name: "scope not granted to a client", rule: readRule, pl: machine},
+		{name: "one of the permissions missing", rule: bothRule, pl: jwt.JWTPayload{Sub: "u", Perms: []string{"users:read"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Allows(tt.pl); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
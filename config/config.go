@@ -0,0 +1,491 @@
+/*
+Package config loads the configuration of the service, once, at startup.
+
+The settings are read, in increasing order of precedence, from
+  - their defaults;
+  - an optional configuration file (YAML or TOML, see ReadFile), set with the '-config' flag or the CONFIG_FILE env var;
+  - the env vars of the optional '.env' file;
+  - the env vars of the process;
+  - the command-line flags (e.g. '-server-addr'), except for the secrets, which would be visible in the process list.
+
+The settings are named after their env vars (e.g. JWT_EXP_MINUTES), in lower case in the configuration file (e.g. 'jwt_exp_minutes')
+and in lower kebab case for the flags (e.g. '-jwt-exp-minutes').
+
+The configuration can be reloaded while the service runs, with a Holder.
+*/
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// MinSecretKeyLength is the least number of bytes of the key signing the JWTs.
+const MinSecretKeyLength = 32
+
+// dotEnvFile is the optional file of env vars.
+const dotEnvFile = ".env"
+
+// Config holds the settings of the service.
+type Config struct {
+	// the configuration file, if any.
+	File string
+
+	ServerAddr  string
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// the listen address of the plain http server of '/metrics', kept off the public https server (see package metrics).
+	// it is only listened on at startup; the metrics are not served when it is empty.
+	MetricsAddr string
+
+	// interval between the checks for a change of the files of the configuration (see Holder.Changed).
+	WatchInterval time.Duration
+
+	// on SIGTERM or SIGINT, the period the server keeps serving while failing its readiness (for the load balancers to stop routing to it),
+	// then the longest wait for the requests in flight to complete. the grace period (5s by default) should exceed the period of the
+	// readiness probe of the load balancer, or the requests routed to the server in the meantime are refused.
+	ShutdownGrace   time.Duration
+	ShutdownTimeout time.Duration
+
+	// the least level of the lines logged.
+	LogLevel slog.Level
+
+	// the exporter of the spans of the traces (see package tracing), i.e. none, stdout or otlp,
+	// and the url of the OpenTelemetry collector the otlp exporter sends them to.
+	TraceExporter     string
+	TraceOTLPEndpoint string
+
+	// the append-only file of the security events (see package audit). it is only opened at startup.
+	AuditLogFile string
+
+	// JWTs issued by the service (see '/auth').
+	JWTSecretKey string
+	JWTIssuer    string
+	JWTExp       time.Duration
+
+	Mailer Mailer
+
+	// password reset and self-registration.
+	ResetTokenTTL    time.Duration
+	PasswordResetURL string
+	VerifyTokenTTL   time.Duration
+	SignupVerifyURL  string
+
+	// OpenID Connect. the signing key is ephemeral when no key file is set.
+	OIDCSigningKeyFile string
+	OIDCIssuerURL      string
+
+	ImpersonationTTL time.Duration
+
+	// the secrets of the confidential OAuth 2.0 clients, by their id.
+	OAuthClientSecrets map[string]string
+
+	// pickup codes. the signing key is ephemeral when no key file is set.
+	PickupSigningKeyFile string
+	PickupCodeTTL        time.Duration
+
+	DelegationTokenTTL    time.Duration
+	DelegationMaxValidity time.Duration
+
+	// the rules of the requests forwarded to '/authz/forward' by the reverse proxies (see package authz), if any.
+	ForwardAuthRulesFile string
+
+	// cookie sessions (see '/auth?mode=cookie').
+	CookieDomain   string
+	CookieSameSite http.SameSite
+}
+
+// Mailer holds the settings of the mailer delivering the password reset and verification links (see mailer.New).
+type Mailer struct {
+	Kind         string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	File         string
+}
+
+// setting is a setting read from the configuration sources.
+type setting struct {
+	key    string
+	def    string
+	usage  string
+	secret bool
+}
+
+// settings are all the settings of the service, by their env var.
+var settings = []setting{
+	{key: "SERVER_ADDR", usage: "listen address of the https server, host:port"},
+	{key: "TLS_CERT_FILE", def: "./ssl/cert03.pem", usage: "pem file of the tls certificate (chain) of the server"},
+	{key: "TLS_KEY_FILE", def: "./ssl/key03.pem", usage: "pem file of the tls private key of the server"},
+	{key: "METRICS_ADDR", def: "localhost:9090", usage: "listen address of the http server of '/metrics', host:port, for the scrapers only (empty to not serve the metrics)"},
+	{key: "CONFIG_WATCH_SECONDS", def: "30", usage: "interval between the checks for a change of the configuration files, in seconds"},
+	{key: "SHUTDOWN_GRACE_SECONDS", def: "5", usage: "period the server keeps serving, while not ready, on shutdown, for the load balancers to stop routing to it, in seconds (0 to stop at once)"},
+	{key: "SHUTDOWN_TIMEOUT_SECONDS", def: "30", usage: "longest wait for the requests in flight to complete on shutdown, in seconds"},
+	{key: "LOG_LEVEL", def: "info", usage: "least level of the lines logged, i.e. debug, info, warn or error"},
+	{key: "TRACE_EXPORTER", def: "none", usage: "exporter of the trace spans, i.e. none, stdout (JSON lines) or otlp (OTLP/HTTP to TRACE_OTLP_ENDPOINT)"},
+	{key: "TRACE_OTLP_ENDPOINT", def: "http://localhost:4318/v1/traces", usage: "url of the OpenTelemetry collector the otlp exporter sends the trace spans to"},
+	{key: "AUDIT_LOG_FILE", def: "./audit.jsonl", usage: "append-only file of the audit log of the security events"},
+	{key: "JWT_SECRET_KEY", usage: "key signing the JWTs", secret: true},
+	{key: "JWT_ISSUER", usage: "'iss' of the JWTs"},
+	{key: "JWT_EXP_MINUTES", usage: "validity of the JWTs, in minutes"},
+	{key: "MAILER", usage: "mailer, i.e. smtp or file"},
+	{key: "MAIL_FROM", usage: "sender of the emails"},
+	{key: "SMTP_HOST", usage: "host of the smtp server"},
+	{key: "SMTP_PORT", usage: "port of the smtp server"},
+	{key: "SMTP_USERNAME", usage: "username on the smtp server"},
+	{key: "SMTP_PASSWORD", usage: "password on the smtp server", secret: true},
+	{key: "MAILER_FILE", usage: "file the emails are written to, with the file mailer"},
+	{key: "RESET_TOKEN_TTL_MINUTES", def: "30", usage: "validity of the password reset tokens, in minutes"},
+	{key: "PASSWORD_RESET_URL", usage: "url of the password reset page"},
+	{key: "VERIFY_TOKEN_TTL_MINUTES", def: "1440", usage: "validity of the email verification tokens, in minutes"},
+	{key: "SIGNUP_VERIFY_URL", usage: "url of the email verification page"},
+	{key: "OIDC_SIGNING_KEY_FILE", usage: "pem file of the RSA key signing the ID tokens"},
+	{key: "OIDC_ISSUER_URL", usage: "issuer url of OpenID Connect (default https://SERVER_ADDR)"},
+	{key: "OAUTH_CLIENT_SECRETS", usage: "secrets of the confidential OAuth 2.0 clients, i.e. id=secret pairs separated by commas", secret: true},
+	{key: "IMPERSONATION_TTL_MINUTES", def: "15", usage: "validity of the impersonation tokens, in minutes"},
+	{key: "PICKUP_SIGNING_KEY_FILE", usage: "pem file of the Ed25519 key signing the pickup codes"},
+	{key: "PICKUP_CODE_TTL_MINUTES", def: "10", usage: "validity of the pickup codes, in minutes"},
+	{key: "DELEGATION_TOKEN_TTL_MINUTES", def: "15", usage: "validity of the delegated tokens, in minutes"},
+	{key: "DELEGATION_MAX_DAYS", def: "30", usage: "longest validity of a delegation, in days"},
+	{key: "FORWARD_AUTH_RULES_FILE", usage: "json file of the roles required by path and method on /authz/forward (default: any authenticated request)"},
+	{key: "COOKIE_DOMAIN", usage: "domain of the session cookies"},
+	{key: "COOKIE_SAMESITE", def: "strict", usage: "SameSite of the session cookies, i.e. strict, lax or none"},
+}
+
+// flagName returns the name of the command-line flag of the setting with the env var, key.
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// Load loads the configuration from the configuration sources, with the command-line arguments, args (without the program name).
+// It fails when a setting is missing or invalid, so the service does not start with a broken configuration.
+func Load(args []string) (*Config, error) {
+
+	// the flags. only the flags set on the command line take precedence over the other sources.
+	fs := flag.NewFlagSet("passer-auth-service", flag.ContinueOnError)
+	file := fs.String("config", "", "configuration file (yaml or toml)")
+	flags := map[string]*string{}
+	for _, s := range settings {
+		if !s.secret {
+			flags[s.key] = fs.String(flagName(s.key), "", s.usage)
+		}
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// the .env file is optional, e.g. the env vars are set by the container runtime.
+	// it is read afresh on every (re)load, without altering the env vars of the process.
+	dotEnv, err := godotenv.Read(dotEnvFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("[Config]: fail to load %s: %w", dotEnvFile, err)
+	}
+	env := func(key string) string {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			return v
+		}
+		return dotEnv[key]
+	}
+
+	values := map[string]string{}
+	for _, s := range settings {
+		values[s.key] = s.def
+	}
+
+	if *file == "" {
+		*file = env("CONFIG_FILE")
+	}
+	if *file != "" {
+		fileValues, err := ReadFile(*file)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range fileValues {
+			values[strings.ToUpper(k)] = v
+		}
+	}
+
+	for _, s := range settings {
+		if v := env(s.key); v != "" {
+			values[s.key] = v
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		for key, v := range flags {
+			if flagName(key) == f.Name {
+				values[key] = *v
+			}
+		}
+	})
+
+	c, err := parse(values)
+	if err != nil {
+		return nil, err
+	}
+	c.File = *file
+
+	return c, nil
+}
+
+// Files returns the files of the configuration, i.e. the files whose change calls for a reload.
+func (c *Config) Files() []string {
+
+	files := []string{}
+	for _, file := range []string{c.File, dotEnvFile, c.TLSCertFile, c.TLSKeyFile, c.OIDCSigningKeyFile, c.PickupSigningKeyFile, c.ForwardAuthRulesFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// parse returns the configuration of the settings' values, by their env var, once validated.
+func parse(values map[string]string) (*Config, error) {
+
+	p := parser{values: values}
+
+	c := &Config{
+		ServerAddr:        p.address("SERVER_ADDR"),
+		TLSCertFile:       p.required("TLS_CERT_FILE"),
+		TLSKeyFile:        p.required("TLS_KEY_FILE"),
+		MetricsAddr:       p.optionalAddress("METRICS_ADDR"),
+		WatchInterval:     p.duration("CONFIG_WATCH_SECONDS", time.Second),
+		ShutdownGrace:     p.nonNegativeDuration("SHUTDOWN_GRACE_SECONDS", time.Second),
+		ShutdownTimeout:   p.duration("SHUTDOWN_TIMEOUT_SECONDS", time.Second),
+		LogLevel:          p.logLevel("LOG_LEVEL"),
+		TraceExporter:     p.oneOf("TRACE_EXPORTER", "none", "stdout", "otlp"),
+		TraceOTLPEndpoint: p.httpURL("TRACE_OTLP_ENDPOINT"),
+		AuditLogFile:      p.required("AUDIT_LOG_FILE"),
+		JWTSecretKey:      p.secretKey("JWT_SECRET_KEY"),
+		JWTIssuer:         p.required("JWT_ISSUER"),
+		JWTExp:            p.duration("JWT_EXP_MINUTES", time.Minute),
+		Mailer: Mailer{
+			Kind:         values["MAILER"],
+			From:         values["MAIL_FROM"],
+			SMTPHost:     values["SMTP_HOST"],
+			SMTPPort:     values["SMTP_PORT"],
+			SMTPUsername: values["SMTP_USERNAME"],
+			SMTPPassword: values["SMTP_PASSWORD"],
+			File:         values["MAILER_FILE"],
+		},
+		ResetTokenTTL:         p.duration("RESET_TOKEN_TTL_MINUTES", time.Minute),
+		PasswordResetURL:      values["PASSWORD_RESET_URL"],
+		VerifyTokenTTL:        p.duration("VERIFY_TOKEN_TTL_MINUTES", time.Minute),
+		SignupVerifyURL:       values["SIGNUP_VERIFY_URL"],
+		OIDCSigningKeyFile:    values["OIDC_SIGNING_KEY_FILE"],
+		OIDCIssuerURL:         strings.TrimSuffix(values["OIDC_ISSUER_URL"], "/"),
+		OAuthClientSecrets:    p.pairs("OAUTH_CLIENT_SECRETS"),
+		ImpersonationTTL:      p.duration("IMPERSONATION_TTL_MINUTES", time.Minute),
+		PickupSigningKeyFile:  values["PICKUP_SIGNING_KEY_FILE"],
+		PickupCodeTTL:         p.duration("PICKUP_CODE_TTL_MINUTES", time.Minute),
+		DelegationTokenTTL:    p.duration("DELEGATION_TOKEN_TTL_MINUTES", time.Minute),
+		DelegationMaxValidity: p.duration("DELEGATION_MAX_DAYS", 24*time.Hour),
+		ForwardAuthRulesFile:  values["FORWARD_AUTH_RULES_FILE"],
+		CookieDomain:          values["COOKIE_DOMAIN"],
+		CookieSameSite:        p.sameSite("COOKIE_SAMESITE"),
+	}
+
+	if c.MetricsAddr != "" && c.MetricsAddr == c.ServerAddr {
+		p.fail("METRICS_ADDR must differ from SERVER_ADDR")
+	}
+
+	if c.OIDCIssuerURL == "" {
+		c.OIDCIssuerURL = fmt.Sprintf("https://%s", c.ServerAddr)
+	}
+
+	if len(p.errs) > 0 {
+		return nil, fmt.Errorf("[Config]: invalid configuration: %s", strings.Join(p.errs, "; "))
+	}
+
+	return c, nil
+}
+
+// parser parses the settings' values, recording the errors, so they are all reported at once.
+type parser struct {
+	values map[string]string
+	errs   []string
+}
+
+func (p *parser) fail(format string, a ...interface{}) {
+	p.errs = append(p.errs, fmt.Sprintf(format, a...))
+}
+
+// required returns the value of the setting, which must be set.
+func (p *parser) required(key string) string {
+
+	v := strings.TrimSpace(p.values[key])
+	if v == "" {
+		p.fail("%s is required", key)
+	}
+
+	return v
+}
+
+// duration returns the value of the setting, a positive integer, in unit.
+func (p *parser) duration(key string, unit time.Duration) time.Duration {
+
+	n, err := strconv.Atoi(strings.TrimSpace(p.values[key]))
+	if err != nil || n <= 0 {
+		p.fail("%s must be a positive integer", key)
+		return 0
+	}
+
+	return time.Duration(n) * unit
+}
+
+// nonNegativeDuration returns the value of the setting, a positive integer or zero, in unit.
+func (p *parser) nonNegativeDuration(key string, unit time.Duration) time.Duration {
+
+	n, err := strconv.Atoi(strings.TrimSpace(p.values[key]))
+	if err != nil || n < 0 {
+		p.fail("%s must be a positive integer or zero", key)
+		return 0
+	}
+
+	return time.Duration(n) * unit
+}
+
+// address returns the value of the setting, a listen address (host:port).
+func (p *parser) address(key string) string {
+
+	v := p.required(key)
+	if v == "" {
+		return ""
+	}
+
+	return p.hostPort(key, v)
+}
+
+// optionalAddress returns the value of the setting, a host:port address, if any.
+func (p *parser) optionalAddress(key string) string {
+
+	v := p.values[key]
+	if v == "" {
+		return ""
+	}
+
+	return p.hostPort(key, v)
+}
+
+// hostPort returns v, the value of the setting, once checked to be a host:port address.
+func (p *parser) hostPort(key, v string) string {
+
+	_, port, err := net.SplitHostPort(v)
+	if err != nil {
+		p.fail("%s must be a host:port address", key)
+		return v
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		p.fail("%s must have a valid port", key)
+	}
+
+	return v
+}
+
+// httpURL returns the value of the setting, an absolute http or https url.
+func (p *parser) httpURL(key string) string {
+
+	v := p.required(key)
+	if v == "" {
+		return ""
+	}
+
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.fail("%s must be an http or https url", key)
+	}
+
+	return v
+}
+
+// secretKey returns the value of the setting, a key of at least MinSecretKeyLength bytes.
+func (p *parser) secretKey(key string) string {
+
+	v := p.values[key]
+	if len(v) < MinSecretKeyLength {
+		p.fail("%s must be at least %d bytes long", key, MinSecretKeyLength)
+	}
+
+	return v
+}
+
+// logLevel returns the value of the setting, a level of the log.
+func (p *parser) logLevel(key string) slog.Level {
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.TrimSpace(p.values[key])))
+	if err != nil {
+		p.fail("%s must be one of debug, info, warn or error", key)
+	}
+
+	return level
+}
+
+// oneOf returns the value of the setting, one of the values allowed, in lower case.
+func (p *parser) oneOf(key string, allowed ...string) string {
+
+	v := strings.ToLower(strings.TrimSpace(p.values[key]))
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+
+	p.fail("%s must be one of %s", key, strings.Join(allowed, ", "))
+	return v
+}
+
+// sameSite returns the value of the setting, a SameSite attribute of the cookies.
+func (p *parser) sameSite(key string) http.SameSite {
+
+	switch strings.ToLower(strings.TrimSpace(p.values[key])) {
+	case "", "strict":
+		return http.SameSiteStrictMode
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+
+	p.fail("%s must be one of strict, lax or none", key)
+	return http.SameSiteDefaultMode
+}
+
+// pairs returns the value of the setting, comma-separated key=value pairs, by their key.
+func (p *parser) pairs(key string) map[string]string {
+
+	m := map[string]string{}
+	for _, pair := range strings.Split(p.values[key], ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			p.fail("%s must be key=value pairs separated by commas", key)
+			return m
+		}
+		m[k] = v
+	}
+
+	return m
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validValues returns the values of a valid configuration: the defaults, with the required settings.
+func validValues() map[string]string {
+
+	values := map[string]string{}
+	for _, s := range settings {
+		values[s.key] = s.def
+	}
+	values["SERVER_ADDR"] = "localhost:5000"
+	values["JWT_SECRET_KEY"] = strings.Repeat("k", MinSecretKeyLength)
+	values["JWT_ISSUER"] = "passer"
+	values["JWT_EXP_MINUTES"] = "60"
+
+	return values
+}
+
+// TestParse checks that the settings are validated, and that all the invalid ones are reported.
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		name string
+		// the values set over validValues.
+		set map[string]string
+		// the settings the error must report, none when the configuration is valid.
+		wantErrs []string
+		check    func(t *testing.T, c *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, c *Config) {
+				if c.JWTExp != time.Hour || c.ResetTokenTTL != 30*time.Minute {
+					t.Errorf("durations: %v, %v", c.JWTExp, c.ResetTokenTTL)
+				}
+				if c.ShutdownGrace != 5*time.Second || c.ShutdownTimeout != 30*time.Second {
+					t.Errorf("shutdown: grace %v, drain timeout %v", c.ShutdownGrace, c.ShutdownTimeout)
+				}
+				if c.MetricsAddr != "localhost:9090" {
+					t.Errorf("MetricsAddr: %s", c.MetricsAddr)
+				}
+				if c.OIDCIssuerURL != "https://localhost:5000" {
+					t.Errorf("OIDCIssuerURL: %s", c.OIDCIssuerURL)
+				}
+				if c.TraceOTLPEndpoint != "http://localhost:4318/v1/traces" {
+					t.Errorf("TraceOTLPEndpoint: %s", c.TraceOTLPEndpoint)
+				}
+				if c.CookieSameSite != http.SameSiteStrictMode || c.TraceExporter != "none" {
+					t.Errorf("CookieSameSite: %v, TraceExporter: %s", c.CookieSameSite, c.TraceExporter)
+				}
+				if len(c.OAuthClientSecrets) != 0 {
+					t.Errorf("OAuthClientSecrets: %v", c.OAuthClientSecrets)
+				}
+			},
+		},
+		{
+			name: "values",
+			set: map[string]string{
+				"OIDC_ISSUER_URL":      "https://auth.passer.com/",
+				"COOKIE_SAMESITE":      "Lax",
+				"TRACE_EXPORTER":       " STDOUT ",
+				"OAUTH_CLIENT_SECRETS": "merchant-portal=s1, locker-station-01 = s=2 ,",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.OIDCIssuerURL != "https://auth.passer.com" {
+					t.Errorf("OIDCIssuerURL: %s", c.OIDCIssuerURL)
+				}
+				if c.CookieSameSite != http.SameSiteLaxMode || c.TraceExporter != "stdout" {
+					t.Errorf("CookieSameSite: %v, TraceExporter: %s", c.CookieSameSite, c.TraceExporter)
+				}
+				want := map[string]string{"merchant-portal": "s1", "locker-station-01": "s=2"}
+				if !reflect.DeepEqual(c.OAuthClientSecrets, want) {
+					t.Errorf("OAuthClientSecrets: want %v, got %v", want, c.OAuthClientSecrets)
+				}
+			},
+		},
+		{name: "missing required settings", set: map[string]string{"SERVER_ADDR": "", "JWT_ISSUER": ""}, wantErrs: []string{"SERVER_ADDR", "JWT_ISSUER"}},
+		{name: "short secret key", set: map[string]string{"JWT_SECRET_KEY": "short"}, wantErrs: []string{"JWT_SECRET_KEY"}},
+		{name: "address without a port", set: map[string]string{"SERVER_ADDR": "localhost"}, wantErrs: []string{"SERVER_ADDR"}},
+		{name: "address with a bad port", set: map[string]string{"SERVER_ADDR": "localhost:70000"}, wantErrs: []string{"SERVER_ADDR"}},
+		{name: "metrics not served", set: map[string]string{"METRICS_ADDR": ""}, check: func(t *testing.T, c *Config) {
+			if c.MetricsAddr != "" {
+				t.Errorf("MetricsAddr: %s", c.MetricsAddr)
+			}
+		}},
+		{name: "metrics address without a port", set: map[string]string{"METRICS_ADDR": "localhost"}, wantErrs: []string{"METRICS_ADDR"}},
+		{name: "metrics on the server address", set: map[string]string{"METRICS_ADDR": "localhost:5000"}, wantErrs: []string{"METRICS_ADDR"}},
+		{name: "durations", set: map[string]string{"JWT_EXP_MINUTES": "0", "RESET_TOKEN_TTL_MINUTES": "ten"}, wantErrs: []string{"JWT_EXP_MINUTES", "RESET_TOKEN_TTL_MINUTES"}},
+		{name: "negative grace", set: map[string]string{"SHUTDOWN_GRACE_SECONDS": "-1"}, wantErrs: []string{"SHUTDOWN_GRACE_SECONDS"}},
+		{name: "log level", set: map[string]string{"LOG_LEVEL": "verbose"}, wantErrs: []string{"LOG_LEVEL"}},
+		{name: "trace exporter", set: map[string]string{"TRACE_EXPORTER": "jaeger"}, wantErrs: []string{"TRACE_EXPORTER"}},
+		{name: "otlp endpoint", set: map[string]string{"TRACE_OTLP_ENDPOINT": "collector:4318"}, wantErrs: []string{"TRACE_OTLP_ENDPOINT"}},
+		{name: "same site", set: map[string]string{"COOKIE_SAMESITE": "sometimes"}, wantErrs: []string{"COOKIE_SAMESITE"}},
+		{name: "client secret without a value", set: map[string]string{"OAUTH_CLIENT_SECRETS": "merchant-portal="}, wantErrs: []string{"OAUTH_CLIENT_SECRETS"}},
+		{name: "client secret without an id", set: map[string]string{"OAUTH_CLIENT_SECRETS": "secret"}, wantErrs: []string{"OAUTH_CLIENT_SECRETS"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			values := validValues()
+			for k, v := range tt.set {
+				values[k] = v
+			}
+
+			c, err := parse(values)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.check != nil {
+					tt.check(t, c)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("want an error on %v", tt.wantErrs)
+			}
+			for _, key := range tt.wantErrs {
+				if !strings.Contains(err.Error(), key) {
+					t.Errorf("the error does not report %s: %v", key, err)
+				}
+			}
+		})
+	}
+}
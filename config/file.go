@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ReadFile reads the settings in the configuration file at path, by their name.
+// The format is told by the extension of the file: YAML ('.yaml', '.yml') or TOML ('.toml'), decoded as such.
+// All the settings are scalars, so they must be top-level keys with a string, number or boolean value
+// (e.g. 'jwt_exp_minutes: 60' or 'jwt_exp_minutes = 60'); a nested mapping (YAML), table (TOML) or list is rejected.
+func ReadFile(path string) (map[string]string, error) {
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Config]: fail to open the configuration file: %w", err)
+	}
+
+	return parseFile(path, b)
+}
+
+// parseFile decodes the content, b, of the configuration file at path, in the format of its extension.
+func parseFile(path string, b []byte) (map[string]string, error) {
+
+	doc := map[string]interface{}{}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		err = toml.Unmarshal(b, &doc)
+	default:
+		return nil, fmt.Errorf("[Config]: %s must be a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[Config]: fail to parse %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	bad := []string{}
+	for key, v := range doc {
+		if v == nil {
+			// an empty value, e.g. 'cookie_domain:' (YAML), leaves the setting to its other sources.
+			continue
+		}
+		s, ok := scalar(v)
+		if !ok {
+			bad = append(bad, key)
+			continue
+		}
+		values[key] = s
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return nil, fmt.Errorf("[Config]: %s: the settings must be strings, numbers or booleans: %s", path, strings.Join(bad, ", "))
+	}
+
+	return values, nil
+}
+
+// scalar returns the value of a setting, v, as decoded from the file, as a string. It is false when v is not a scalar.
+func scalar(v interface{}) (string, bool) {
+
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseFile checks that the YAML and TOML files are decoded, and that only the scalar top-level settings are accepted.
+func TestParseFile(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			path: "passer.yaml",
+			content: `---
+# the https server.
+server_addr: localhost:5000
+jwt_exp_minutes: 60 # an hour
+jwt_issuer: "passer # auth"
+mail_from: 'noreply@passer.com'
+cookie_samesite: >-
+  lax
+cookie_domain:
+trace: true
+`,
+			want: map[string]string{
+				"server_addr":     "localhost:5000",
+				"jwt_exp_minutes": "60",
+				"jwt_issuer":      "passer # auth",
+				"mail_from":       "noreply@passer.com",
+				"cookie_samesite": "lax",
+				"trace":           "true",
+			},
+		},
+		{
+			name:    "yml with an escaped value",
+			path:    "passer.yml",
+			content: `password_reset_url: "https://passer.com/reset?token=&"`,
+			want:    map[string]string{"password_reset_url": "https://passer.com/reset?token=&"},
+		},
+		{
+			name: "toml",
+			path: "passer.toml",
+			content: `# the https server.
+server_addr = "localhost:5000"
+jwt_exp_minutes = 60 # an hour
+jwt_issuer = 'passer # auth'
+shutdown_grace_seconds = 1.5
+`,
+			want: map[string]string{
+				"server_addr":            "localhost:5000",
+				"jwt_exp_minutes":        "60",
+				"jwt_issuer":             "passer # auth",
+				"shutdown_grace_seconds": "1.5",
+			},
+		},
+		{name: "empty yaml", path: "passer.yaml", content: "", want: map[string]string{}},
+		{name: "yaml mapping", path: "passer.yaml", content: "mailer:\n  kind: smtp\n", wantErr: true},
+		{name: "yaml list", path: "passer.yaml", content: "server_addr:\n  - localhost:5000\n", wantErr: true},
+		{name: "yaml syntax", path: "passer.yaml", content: "server_addr: [localhost", wantErr: true},
+		{name: "toml table", path: "passer.toml", content: "[mailer]\nkind = \"smtp\"\n", wantErr: true},
+		{name: "toml syntax", path: "passer.toml", content: "server_addr = localhost:5000\n", wantErr: true},
+		{name: "toml duplicated key", path: "passer.toml", content: "a = 1\na = 2\n", wantErr: true},
+		{name: "other extension", path: "passer.json", content: `{"server_addr": "localhost:5000"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := parseFile(tt.path, []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestReadFile checks that the file is read from the disk, and that a missing file fails.
+func TestReadFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "passer.yaml")
+	err := os.WriteFile(path, []byte("jwt_issuer: passer\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["jwt_issuer"] != "passer" {
+		t.Errorf("jwt_issuer: want passer, got %q", got["jwt_issuer"])
+	}
+
+	_, err = ReadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil {
+		t.Error("a missing file was read")
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Holder holds the configuration in force, with the TLS certificate of the server, and reloads them on demand
+// (e.g. on SIGHUP, or when Changed reports that a file has changed), so the certificates, the signing keys
+// and the tunables are renewed without a restart.
+type Holder struct {
+	args  []string
+	apply func(*Config) error
+
+	// serialises the reloads.
+	reloading sync.Mutex
+
+	mu   sync.RWMutex
+	cfg  *Config
+	cert *tls.Certificate
+
+	// modification times of the files of the configuration, at the last (re)load.
+	modTimes map[string]time.Time
+}
+
+// NewHolder loads the configuration with the command-line arguments, args, and the TLS certificate it sets.
+// The configuration is passed to apply, which puts it in force (e.g. builds the handlers with it), on this load and on every reload.
+func NewHolder(args []string, apply func(*Config) error) (*Holder, error) {
+
+	h := &Holder{args: args, apply: apply}
+
+	err := h.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Current returns the configuration in force.
+func (h *Holder) Current() *Config {
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.cfg
+}
+
+// GetCertificate returns the TLS certificate in force. It is the tls.Config.GetCertificate hook of the server,
+// so a renewed certificate is served to the new connections, while the established ones carry on.
+func (h *Holder) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.cert, nil
+}
+
+// Reload loads the configuration and the TLS certificate again, from the same sources, and puts them in force.
+// The configuration in force is kept when the new one is invalid or cannot be applied, so a bad edit never takes the service down.
+func (h *Holder) Reload() error {
+
+	h.reloading.Lock()
+	defer h.reloading.Unlock()
+
+	cfg, err := Load(h.args)
+	if err != nil {
+		// the files are recorded all the same, so a broken file is only reported once, until it changes again.
+		h.recordModTimes(h.files(cfg))
+		return err
+	}
+	h.recordModTimes(cfg.Files())
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("[Config]: fail to load the tls certificate: %w", err)
+	}
+
+	err = h.apply(cfg)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.cfg = cfg
+	h.cert = &cert
+	h.mu.Unlock()
+
+	return nil
+}
+
+// Changed checks if any file of the configuration has been modified, created or removed since the last (re)load.
+func (h *Holder) Changed() bool {
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for file, t := range h.modTimes {
+		if !modTime(file).Equal(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// files returns the files of the configuration, cfg, or of the configuration in force when cfg failed to load.
+func (h *Holder) files(cfg *Config) []string {
+
+	if cfg != nil {
+		return cfg.Files()
+	}
+	if current := h.Current(); current != nil {
+		return current.Files()
+	}
+
+	return []string{dotEnvFile}
+}
+
+func (h *Holder) recordModTimes(files []string) {
+
+	modTimes := map[string]time.Time{}
+	for _, file := range files {
+		modTimes[file] = modTime(file)
+	}
+
+	h.mu.Lock()
+	h.modTimes = modTimes
+	h.mu.Unlock()
+}
+
+// modTime returns the modification time of the file, or the zero time when the file does not exist.
+func modTime(file string) time.Time {
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return fi.ModTime()
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var ErrAPIKeyNotFound error = errors.New("[APIKeys]: api key not found")
+
+// APIKeyStore is the in-memory data store of the API keys, keyed by the key id.
+type APIKeyStore struct {
+	mu  sync.RWMutex
+	avl *avl.AVL
+}
+
+// NewAPIKeyStore instantiates an empty APIKeyStore.
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{avl: avl.New()}
+}
+
+// Insert adds the key to the store.
+func (s *APIKeyStore) Insert(k models.APIKey) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.avl.InsertNode(k, k.Id)
+}
+
+// Find returns the key with the id.
+func (s *APIKeyStore) Find(id string) (models.APIKey, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+
+	return found.GetItem().(models.APIKey), nil
+}
+
+// ListByUser returns the keys of the user, in ascending id order.
+func (s *APIKeyStore) ListByUser(userId string) []models.APIKey {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	keys := []models.APIKey{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		k := item.(models.APIKey)
+		if k.UserId == userId {
+			// the stack pops in descending order.
+			keys = append([]models.APIKey{k}, keys...)
+		}
+	}
+
+	return keys
+}
+
+// Remove revokes the key with the id, when it belongs to the user.
+func (s *APIKeyStore) Remove(id string, userId string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(id)
+	if found == nil || found.GetItem().(models.APIKey).UserId != userId {
+		return ErrAPIKeyNotFound
+	}
+
+	return s.avl.Remove(id)
+}
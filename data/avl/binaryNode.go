@@ -93,12 +93,14 @@ func (n *BinaryNode) balanceFactor() int {
 	return n.left.Height() - n.right.Height()
 }
 
+// a new node is a leaf, i.e. its height is 1, the height of a nil (empty) sub-tree being 0.
 func newNode(item interface{}, id string) *BinaryNode {
 	return &BinaryNode{
-		id:    id,
-		item:  item,
-		left:  nil,
-		right: nil,
+		id:     id,
+		item:   item,
+		left:   nil,
+		right:  nil,
+		height: 1,
 	}
 }
 
@@ -157,23 +159,23 @@ func rotateInsert(node *BinaryNode) *BinaryNode {
 	bf := node.balanceFactor()
 
 	// nodes lined-up to the left
-	if bf > 1 && node.id < node.left.id {
+	if bf > 1 && node.left.balanceFactor() >= 0 {
 		return rightRotate(node)
 	}
 
 	// nodes lined-up to the right
-	if bf < -1 && node.id > node.right.id {
+	if bf < -1 && node.right.balanceFactor() <= 0 {
 		return leftRotate(node)
 	}
 
 	// nodes lined-up to a 'less than' shape
-	if bf > 1 && node.id > node.left.id {
+	if bf > 1 && node.left.balanceFactor() < 0 {
 		node.left = leftRotate(node.left)
 		return rightRotate(node)
 	}
 
 	// nodes lined-up to a 'greater than' shape
-	if bf < -1 && node.id < node.right.id {
+	if bf < -1 && node.right.balanceFactor() > 0 {
 		node.right = rightRotate(node.right)
 		return leftRotate(node)
 	}
@@ -273,10 +275,11 @@ func removeNode(node *BinaryNode, id string) (*BinaryNode, error) {
 			// find successor
 			successor := least(node.right)
 			// successor := greatest(node.left)
+			successorId := successor.id
 			item := successor.item
 
 			// remove the successor
-			right, err := removeNode(node.right, id)
+			right, err := removeNode(node.right, successorId)
 			// left, err := removeNode(node.left, id)
 			if err != nil {
 				return nil, err
@@ -284,6 +287,7 @@ func removeNode(node *BinaryNode, id string) (*BinaryNode, error) {
 			node.right = right
 			// node.left = left
 
+			node.id = successorId
 			node.item = item
 
 		} else if node.left != nil || node.right != nil {
@@ -359,3 +363,14 @@ func updateNode(n **BinaryNode, updated interface{}, id string) error {
 
 	return nil
 }
+
+/*
+	Private function to count the nodes of the sub-tree, wrt a specific node.
+*/
+func countNodes(node *BinaryNode) int {
+	if node == nil {
+		return 0
+	}
+
+	return countNodes(node.left) + 1 + countNodes(node.right)
+}
@@ -176,3 +176,17 @@ func (tree *AVL) Update(id string, updated interface{}) (*BinaryNode, error) {
 
 	return found, nil
 }
+
+/*
+	Function to count the nodes in the avl tree.
+*/
+func (tree *AVL) Size() int {
+	return countNodes(tree.root)
+}
+
+/*
+	Function to get the height of the avl tree, i.e. the height of its root node.
+*/
+func (tree *AVL) Height() int {
+	return tree.root.Height()
+}
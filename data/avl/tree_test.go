@@ -0,0 +1,196 @@
+package avl
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+// checkTree fails the test when the ids of the sub-tree of node are not in order, or when a node has a wrong height
+// or is out of balance. It returns the ids, in order.
+func checkTree(t *testing.T, node *BinaryNode) []string {
+	t.Helper()
+
+	if node == nil {
+		return nil
+	}
+
+	left := checkTree(t, node.left)
+	right := checkTree(t, node.right)
+
+	if want := max(height(node.left), height(node.right)) + 1; node.height != want {
+		t.Errorf("node %s: height %d, want %d", node.id, node.height, want)
+	}
+	if bf := height(node.left) - height(node.right); bf < -1 || bf > 1 {
+		t.Errorf("node %s: balance factor %d", node.id, bf)
+	}
+
+	if len(left) > 0 && left[len(left)-1] >= node.id {
+		t.Errorf("node %s: left sub-tree holds %s", node.id, left[len(left)-1])
+	}
+	if len(right) > 0 && right[0] <= node.id {
+		t.Errorf("node %s: right sub-tree holds %s", node.id, right[0])
+	}
+
+	ids := append(left, node.id)
+	return append(ids, right...)
+}
+
+// height returns the height of the sub-tree of node, counted from its nodes.
+func height(node *BinaryNode) int {
+	if node == nil {
+		return 0
+	}
+	return max(height(node.left), height(node.right)) + 1
+}
+
+// TestInsertBalance checks that the tree stays balanced, with the right heights, whatever the order of the inserts.
+func TestInsertBalance(t *testing.T) {
+
+	const n = 100
+
+	// ids returns the n ids, from "id000", in the order of the indexes returned by at.
+	ids := func(at func(i int) int) []string {
+		v := make([]string, n)
+		for i := range v {
+			v[i] = fmt.Sprintf("id%03d", at(i))
+		}
+		return v
+	}
+	perm := rand.New(rand.NewSource(1)).Perm(n)
+
+	tests := []struct {
+		name string
+		ids  []string
+	}{
+		{name: "ascending", ids: ids(func(i int) int { return i })},
+		{name: "descending", ids: ids(func(i int) int { return n - 1 - i })},
+		// 0, 99, 1, 98, ...
+		{name: "zig-zag", ids: ids(func(i int) int {
+			if i%2 == 0 {
+				return i / 2
+			}
+			return n - 1 - i/2
+		})},
+		// 50, 49, 51, 48, ... i.e. from the middle outwards.
+		{name: "outwards", ids: ids(func(i int) int {
+			if i%2 == 0 {
+				return n/2 + i/2
+			}
+			return n/2 - 1 - i/2
+		})},
+		{name: "left-right", ids: []string{"c", "a", "b"}},
+		{name: "right-left", ids: []string{"a", "c", "b"}},
+		{name: "random", ids: ids(func(i int) int { return perm[i] })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			tree := New()
+			for _, id := range tt.ids {
+				err := tree.InsertNode("item "+id, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := checkTree(t, tree.root)
+			if len(got) != len(tt.ids) {
+				t.Fatalf("%d ids in the tree, want %d", len(got), len(tt.ids))
+			}
+
+			// the height of an AVL tree of n nodes is less than 1.44 * log2(n + 2).
+			if h, limit := height(tree.root), 1.44*math.Log2(float64(len(tt.ids)+2)); float64(h) >= limit {
+				t.Errorf("height %d, want less than %.1f", h, limit)
+			}
+
+			for _, id := range tt.ids {
+				if tree.Find(id) == nil {
+					t.Errorf("%s is not found", id)
+				}
+			}
+		})
+	}
+}
+
+// TestRemoveBalance checks that the tree stays balanced, with the right heights, as its nodes are removed.
+func TestRemoveBalance(t *testing.T) {
+
+	tree := New()
+	for i := 0; i < 64; i++ {
+		id := fmt.Sprintf("id%03d", i)
+		err := tree.InsertNode("item "+id, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// remove one id out of two, then the lower half of the others.
+	for i := 0; i < 64; i += 2 {
+		err := tree.Remove(fmt.Sprintf("id%03d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, tree.root)
+	}
+	for i := 1; i < 32; i += 2 {
+		err := tree.Remove(fmt.Sprintf("id%03d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, tree.root)
+	}
+
+	if got := len(checkTree(t, tree.root)); got != 16 {
+		t.Errorf("%d ids left, want 16", got)
+	}
+}
+
+// TestRemoveNodeWithTwoChildren checks that removing a node with two children removes that node only:
+// its successor takes its place, with its id, so the successor can still be found by its id.
+func TestRemoveNodeWithTwoChildren(t *testing.T) {
+
+	tree := New()
+	for _, id := range []string{"d", "b", "f", "a", "c", "e", "g"} {
+		err := tree.InsertNode("item "+id, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 'd' (the root) and 'b' have two children.
+	for _, id := range []string{"d", "b"} {
+		err := tree.Remove(id)
+		if err != nil {
+			t.Fatalf("Remove(%s): %v", id, err)
+		}
+		if tree.Find(id) != nil {
+			t.Errorf("%s is still found after its removal", id)
+		}
+	}
+
+	ids := checkTree(t, tree.root)
+	if fmt.Sprint(ids) != "[a c e f g]" {
+		t.Errorf("ids after the removals: %v, want [a c e f g]", ids)
+	}
+	for _, id := range ids {
+		n := tree.Find(id)
+		if n == nil {
+			t.Errorf("%s is not found after the removals", id)
+			continue
+		}
+		if n.Item() != "item "+id {
+			t.Errorf("%s holds %v", id, n.Item())
+		}
+	}
+
+	s := stack.New()
+	tree.ListAllNodes(&s)
+	if s.GetSize() != 5 {
+		t.Errorf("%d items listed, want 5", s.GetSize())
+	}
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrClientNotFound   error = errors.New("[OAuth]: client not found")
+	ErrAuthCodeNotFound error = errors.New("[OAuth]: authorization code not found")
+	ErrAuthCodeExpired  error = errors.New("[OAuth]: authorization code has expired")
+)
+
+// ClientStore is the in-memory data store of the registered OAuth 2.0 clients, keyed by the client id.
+type ClientStore struct {
+	mu  sync.RWMutex
+	avl *avl.AVL
+}
+
+// NewClientStore instantiates an empty ClientStore.
+func NewClientStore() *ClientStore {
+	return &ClientStore{avl: avl.New()}
+}
+
+// Insert registers the client.
+func (cs *ClientStore) Insert(c models.Client) error {
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.avl.InsertNode(c, c.Id)
+}
+
+// Find returns the client registered with id.
+func (cs *ClientStore) Find(id string) (models.Client, error) {
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	found := cs.avl.Find(id)
+	if found == nil {
+		return models.Client{}, ErrClientNotFound
+	}
+
+	return found.GetItem().(models.Client), nil
+}
+
+// List returns all the registered clients.
+func (cs *ClientStore) List() []models.Client {
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	st := stack.New()
+	cs.avl.ListAllNodes(&st)
+
+	clients := []models.Client{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		clients = append(clients, item.(models.Client))
+	}
+
+	return clients
+}
+
+// SetSecretHash sets the hash of the secret of the client registered with id, e.g. on a reload of the configuration.
+// An empty hash leaves a confidential client unable to authenticate.
+func (cs *ClientStore) SetSecretHash(id string, hash string) error {
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	found := cs.avl.Find(id)
+	if found == nil {
+		return ErrClientNotFound
+	}
+
+	c := found.GetItem().(models.Client)
+	c.SecretHash = hash
+	_, err := cs.avl.Update(id, c)
+
+	return err
+}
+
+// AuthCodeStore is the in-memory data store of the OAuth 2.0 authorization codes, keyed by the code hash.
+type AuthCodeStore struct {
+	mu  sync.Mutex
+	avl *avl.AVL
+}
+
+// NewAuthCodeStore instantiates an empty AuthCodeStore.
+func NewAuthCodeStore() *AuthCodeStore {
+	return &AuthCodeStore{avl: avl.New()}
+}
+
+// Insert adds the code to the store.
+func (s *AuthCodeStore) Insert(c models.AuthCode) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.avl.InsertNode(c, c.Hash)
+}
+
+// Consume removes the code matching hash from the store and returns it.
+// A code can only be consumed once; an expired code is removed but not returned.
+func (s *AuthCodeStore) Consume(hash string) (models.AuthCode, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(hash)
+	if found == nil {
+		return models.AuthCode{}, ErrAuthCodeNotFound
+	}
+
+	c := found.GetItem().(models.AuthCode)
+	err := s.avl.Remove(hash)
+	if err != nil {
+		return models.AuthCode{}, err
+	}
+
+	if c.HasExpired(time.Now()) {
+		return models.AuthCode{}, ErrAuthCodeExpired
+	}
+
+	return c, nil
+}
+
+// RemoveExpired removes the codes that have come to pass at time, now, i.e. the codes that were never redeemed.
+func (s *AuthCodeStore) RemoveExpired(now time.Time) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	hashes := []string{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		c := item.(models.AuthCode)
+		if c.HasExpired(now) {
+			hashes = append(hashes, c.Hash)
+		}
+	}
+
+	for _, hash := range hashes {
+		s.avl.Remove(hash)
+	}
+
+	return len(hashes)
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrDelegationNotFound error = errors.New("[Delegations]: delegation not found")
+	ErrDelegationRevoked  error = errors.New("[Delegations]: delegation has already been revoked")
+)
+
+// DelegationStore is the in-memory data store of the delegation grants, keyed by the grant id.
+type DelegationStore struct {
+	mu  sync.RWMutex
+	avl *avl.AVL
+}
+
+// NewDelegationStore instantiates an empty DelegationStore.
+func NewDelegationStore() *DelegationStore {
+	return &DelegationStore{avl: avl.New()}
+}
+
+// Insert adds the grant to the store.
+func (s *DelegationStore) Insert(d models.Delegation) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.avl.InsertNode(d, d.Id)
+}
+
+// Find returns the grant with the id.
+func (s *DelegationStore) Find(id string) (models.Delegation, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.Delegation{}, ErrDelegationNotFound
+	}
+
+	return found.GetItem().(models.Delegation), nil
+}
+
+// ListByConsumer returns the grants given by the consumer.
+func (s *DelegationStore) ListByConsumer(consumerId string) []models.Delegation {
+	return s.list(func(d models.Delegation) bool { return d.ConsumerId == consumerId })
+}
+
+// ListByAgent returns the grants received by the agent.
+func (s *DelegationStore) ListByAgent(agentId string) []models.Delegation {
+	return s.list(func(d models.Delegation) bool { return d.AgentId == agentId })
+}
+
+// Revoke revokes the grant with the id, at time, now. Only the consumer or the agent of the grant (userId) can revoke it.
+func (s *DelegationStore) Revoke(id string, userId string, now time.Time) (models.Delegation, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.Delegation{}, ErrDelegationNotFound
+	}
+
+	d := found.GetItem().(models.Delegation)
+	if d.ConsumerId != userId && d.AgentId != userId {
+		// not a party of the grant. do not reveal that the grant exists.
+		return models.Delegation{}, ErrDelegationNotFound
+	}
+	if !d.RevokedAt.IsZero() {
+		return models.Delegation{}, ErrDelegationRevoked
+	}
+
+	d.RevokedAt = now
+	s.avl.Update(id, d)
+	return d, nil
+}
+
+// RemoveInactive removes the grants that have been revoked, or have expired, at time, now.
+// The delegated tokens minted from a removed grant are still rejected, as they have no grant (see users.Delegations.IsRevoked).
+func (s *DelegationStore) RemoveInactive(now time.Time) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	ids := []string{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		d := item.(models.Delegation)
+		if !d.RevokedAt.IsZero() || !now.Before(d.ExpiresAt) {
+			ids = append(ids, d.Id)
+		}
+	}
+
+	for _, id := range ids {
+		s.avl.Remove(id)
+	}
+
+	return len(ids)
+}
+
+// list returns the grants selected, in ascending id order.
+func (s *DelegationStore) list(selected func(d models.Delegation) bool) []models.Delegation {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	grants := []models.Delegation{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		d := item.(models.Delegation)
+		if selected(d) {
+			grants = append([]models.Delegation{d}, grants...)
+		}
+	}
+
+	return grants
+}
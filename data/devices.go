@@ -0,0 +1,205 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrDeviceCodeNotFound   error = errors.New("[OAuth]: device code not found")
+	ErrDeviceCodeExpired    error = errors.New("[OAuth]: device code has expired")
+	ErrDeviceCodeDenied     error = errors.New("[OAuth]: device authorization was denied")
+	ErrAuthorizationPending error = errors.New("[OAuth]: device authorization is pending")
+	ErrSlowDown             error = errors.New("[OAuth]: device is polling too frequently")
+	ErrDeviceCodeNotPending error = errors.New("[OAuth]: device authorization is no longer pending")
+	ErrDuplicatedDeviceCode error = errors.New("[OAuth]: device code or user code already issued")
+)
+
+// slowDownIncrement is added to the polling interval of a device that polls too frequently (RFC 8628, section 3.5).
+const slowDownIncrement = 5 * time.Second
+
+// DeviceCodeStore is the in-memory data store of the device authorizations,
+// keyed by the device code hash and indexed by the user code.
+type DeviceCodeStore struct {
+	mu         sync.Mutex
+	avl        *avl.AVL
+	byUserCode *avl.AVL
+}
+
+// NewDeviceCodeStore instantiates an empty DeviceCodeStore.
+func NewDeviceCodeStore() *DeviceCodeStore {
+	return &DeviceCodeStore{avl: avl.New(), byUserCode: avl.New()}
+}
+
+// Insert adds the device authorization to the store.
+func (s *DeviceCodeStore) Insert(d models.DeviceCode) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.avl.Find(d.Hash) != nil || s.byUserCode.Find(d.UserCode) != nil {
+		return ErrDuplicatedDeviceCode
+	}
+
+	err := s.avl.InsertNode(d, d.Hash)
+	if err != nil {
+		return err
+	}
+
+	return s.byUserCode.InsertNode(d.Hash, d.UserCode)
+}
+
+// FindByUserCode returns the pending device authorization of the user code.
+func (s *DeviceCodeStore) FindByUserCode(userCode string) (models.DeviceCode, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.findByUserCode(userCode)
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	if d.Status != models.DeviceStatusPending {
+		return models.DeviceCode{}, ErrDeviceCodeNotPending
+	}
+
+	return d, nil
+}
+
+// Approve records that the user approved the pending device authorization of the user code.
+func (s *DeviceCodeStore) Approve(userCode string, userId string, authTime time.Time) error {
+	return s.decide(userCode, models.DeviceStatusApproved, userId, authTime)
+}
+
+// Deny records that the user denied the pending device authorization of the user code.
+func (s *DeviceCodeStore) Deny(userCode string) error {
+	return s.decide(userCode, models.DeviceStatusDenied, "", time.Time{})
+}
+
+// Poll is called on every token request of the device, the client with clientId (RFC 8628, section 3.5).
+// It returns the approved device authorization, which is then removed from the store (i.e. single-use), or
+// ErrAuthorizationPending, ErrSlowDown, ErrDeviceCodeDenied or ErrDeviceCodeExpired.
+// Polling faster than the interval increases the interval by 5 seconds.
+// A device code issued to another client is not found, and is left as it is for its own client.
+func (s *DeviceCodeStore) Poll(hash string, clientId string, now time.Time) (models.DeviceCode, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(hash)
+	if found == nil {
+		return models.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+
+	d := found.GetItem().(models.DeviceCode)
+	if d.ClientId != clientId {
+		return models.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+	if d.HasExpired(now) {
+		s.remove(d)
+		return models.DeviceCode{}, ErrDeviceCodeExpired
+	}
+
+	switch d.Status {
+	case models.DeviceStatusApproved:
+		s.remove(d)
+		return d, nil
+	case models.DeviceStatusDenied:
+		s.remove(d)
+		return models.DeviceCode{}, ErrDeviceCodeDenied
+	}
+
+	// still pending.
+	tooFast := !d.LastPolledAt.IsZero() && now.Sub(d.LastPolledAt) < d.Interval
+	if tooFast {
+		d.Interval += slowDownIncrement
+	}
+	d.LastPolledAt = now
+	s.avl.Update(d.Hash, d)
+
+	if tooFast {
+		return models.DeviceCode{}, ErrSlowDown
+	}
+	return models.DeviceCode{}, ErrAuthorizationPending
+}
+
+// RemoveExpired removes the device authorizations that have come to pass at time, now, i.e. the device codes that were never polled to the end.
+func (s *DeviceCodeStore) RemoveExpired(now time.Time) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	expired := []models.DeviceCode{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		d := item.(models.DeviceCode)
+		if d.HasExpired(now) {
+			expired = append(expired, d)
+		}
+	}
+
+	for _, d := range expired {
+		s.remove(d)
+	}
+
+	return len(expired)
+}
+
+// decide records the user's decision on the pending device authorization of the user code.
+func (s *DeviceCodeStore) decide(userCode string, status string, userId string, authTime time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.findByUserCode(userCode)
+	if err != nil {
+		return err
+	}
+
+	if d.Status != models.DeviceStatusPending {
+		return ErrDeviceCodeNotPending
+	}
+
+	d.Status = status
+	d.UserId = userId
+	d.AuthTime = authTime
+	_, err = s.avl.Update(d.Hash, d)
+	return err
+}
+
+// findByUserCode returns the unexpired device authorization of the user code. The caller must hold the lock.
+func (s *DeviceCodeStore) findByUserCode(userCode string) (models.DeviceCode, error) {
+
+	idx := s.byUserCode.Find(userCode)
+	if idx == nil {
+		return models.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+
+	found := s.avl.Find(idx.GetItem().(string))
+	if found == nil {
+		return models.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+
+	d := found.GetItem().(models.DeviceCode)
+	if d.HasExpired(time.Now()) {
+		s.remove(d)
+		return models.DeviceCode{}, ErrDeviceCodeExpired
+	}
+
+	return d, nil
+}
+
+// remove removes the device authorization and its user code index. The caller must hold the lock.
+func (s *DeviceCodeStore) remove(d models.DeviceCode) {
+	s.avl.Remove(d.Hash)
+	s.byUserCode.Remove(d.UserCode)
+}
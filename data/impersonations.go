@@ -0,0 +1,138 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrImpersonationNotFound error = errors.New("[Impersonation]: impersonation session not found")
+	ErrImpersonationEnded    error = errors.New("[Impersonation]: impersonation session has already ended")
+)
+
+// ImpersonationStore is the in-memory data store of the impersonation sessions, keyed by the session id.
+type ImpersonationStore struct {
+	mu  sync.RWMutex
+	avl *avl.AVL
+}
+
+// NewImpersonationStore instantiates an empty ImpersonationStore.
+func NewImpersonationStore() *ImpersonationStore {
+	return &ImpersonationStore{avl: avl.New()}
+}
+
+// Insert adds the session to the store.
+func (s *ImpersonationStore) Insert(i models.Impersonation) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.avl.InsertNode(i, i.Id)
+}
+
+// Find returns the session with the id.
+func (s *ImpersonationStore) Find(id string) (models.Impersonation, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.Impersonation{}, ErrImpersonationNotFound
+	}
+
+	return found.GetItem().(models.Impersonation), nil
+}
+
+// ListAll returns all the sessions, in ascending id order.
+func (s *ImpersonationStore) ListAll() []models.Impersonation {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	sessions := make([]models.Impersonation, st.GetSize())
+	for i := len(sessions) - 1; i >= 0; i-- {
+		item, _ := st.Pop()
+		sessions[i] = item.(models.Impersonation)
+	}
+
+	return sessions
+}
+
+// End ends the session with the id, at time, now.
+func (s *ImpersonationStore) End(id string, now time.Time) (models.Impersonation, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.Impersonation{}, ErrImpersonationNotFound
+	}
+
+	i := found.GetItem().(models.Impersonation)
+	if i.HasEnded(now) {
+		return models.Impersonation{}, ErrImpersonationEnded
+	}
+
+	i.EndedAt = now
+	s.avl.Update(id, i)
+	return i, nil
+}
+
+// EndExpired ends the sessions that have come to pass at time, now, and returns them.
+func (s *ImpersonationStore) EndExpired(now time.Time) []models.Impersonation {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	ended := []models.Impersonation{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		i := item.(models.Impersonation)
+		if i.EndedAt.IsZero() && i.HasEnded(now) {
+			i.EndedAt = i.ExpiresAt
+			s.avl.Update(i.Id, i)
+			ended = append(ended, i)
+		}
+	}
+
+	return ended
+}
+
+// RemoveExpired removes the sessions that have come to pass at time, now. The sessions ended earlier are kept until then,
+// as their tokens are only refused while their session is found (see users.Impersonation.IsRevoked).
+func (s *ImpersonationStore) RemoveExpired(now time.Time) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	ids := []string{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		i := item.(models.Impersonation)
+		if !now.Before(i.ExpiresAt) {
+			ids = append(ids, i.Id)
+		}
+	}
+
+	for _, id := range ids {
+		s.avl.Remove(id)
+	}
+
+	return len(ids)
+}
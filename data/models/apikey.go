@@ -0,0 +1,56 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so that a leaked key is easy to recognise (e.g. by secret scanners).
+const APIKeyPrefix = "psr_"
+
+// APIKey is a long-lived credential a user (e.g. a merchant integration) creates and revokes without sharing the password.
+// Only the hash of the key is kept; the key itself is shown once, when it is created.
+// A zero ExpiresAt means the key does not expire; an empty AllowedIPs means the key may be used from any ip.
+type APIKey struct {
+	Id         string    `json:"id"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"-"`
+	UserId     string    `json:"userId"`
+	Scopes     []string  `json:"scopes"`
+	AllowedIPs []string  `json:"allowedIps"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// HasExpired checks if the key has come to pass at time, now. A key without an expiry never expires.
+func (k APIKey) HasExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// AllowsIP checks if the key may be used from the ip. A key without an allowlist may be used from any ip.
+// The allowlist entries are ip addresses or CIDR blocks.
+func (k APIKey) AllowsIP(ip string) bool {
+
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, entry := range k.AllowedIPs {
+		if strings.Contains(entry, "/") {
+			_, block, err := net.ParseCIDR(entry)
+			if err == nil && block.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// Client is an OAuth 2.0 client (e.g. the merchant web portal, the consumer mobile app) registered with the service.
+type Client struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	SecretHash   string   `json:"-"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grantTypes"`
+	Audiences    []string `json:"audiences"`
+	IsPublic     bool     `json:"isPublic"`
+}
+
+// AllowsAudience checks if the client may request tokens restricted to the audience (e.g. another PASSER service).
+func (c Client) AllowsAudience(aud string) bool {
+	for _, a := range c.Audiences {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrant checks if the client may use the grant type (e.g. "authorization_code", "client_credentials").
+func (c Client) AllowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRedirectURI checks if uri is one of the redirect uris registered for the client.
+// The uri must match exactly.
+func (c Client) HasRedirectURI(uri string) bool {
+	for _, r := range c.RedirectURIs {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes checks if all the scopes are allowed for the client.
+func (c Client) AllowsScopes(scopes []string) bool {
+	for _, s := range scopes {
+		allowed := false
+		for _, cs := range c.Scopes {
+			if s == cs {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthCode is an OAuth 2.0 authorization code issued to a client on behalf of a user.
+// Only the hash of the code is kept.
+type AuthCode struct {
+	Hash          string
+	ClientId      string
+	RedirectURI   string
+	UserId        string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+}
+
+// HasExpired checks if the code has come to pass at time, now.
+func (c AuthCode) HasExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
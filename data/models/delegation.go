@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Delegation is a grant by a consumer authorizing an agent to act on the consumer's behalf (e.g. to collect the consumer's parcels),
+// with the scopes, within the validity window [NotBefore, ExpiresAt). A zero RevokedAt means the grant has not been revoked.
+type Delegation struct {
+	Id         string    `json:"id"`
+	ConsumerId string    `json:"consumerId"`
+	AgentId    string    `json:"agentId"`
+	Scopes     []string  `json:"scopes"`
+	NotBefore  time.Time `json:"notBefore"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	RevokedAt  time.Time `json:"revokedAt"`
+}
+
+// IsValid checks if the grant is in force at time, now.
+func (d Delegation) IsValid(now time.Time) bool {
+	return d.RevokedAt.IsZero() && !now.Before(d.NotBefore) && now.Before(d.ExpiresAt)
+}
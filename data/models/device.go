@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Device code statuses.
+const (
+	DeviceStatusPending  = "PENDING"
+	DeviceStatusApproved = "APPROVED"
+	DeviceStatusDenied   = "DENIED"
+)
+
+// DeviceCode is an OAuth 2.0 device authorization (RFC 8628) issued to a device (e.g. a locker station kiosk).
+// The device polls with the device code while the user approves the user code on another device.
+// Only the hash of the device code is kept.
+type DeviceCode struct {
+	Hash         string
+	UserCode     string
+	ClientId     string
+	Scopes       []string
+	Status       string
+	UserId       string
+	AuthTime     time.Time
+	Interval     time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+}
+
+// HasExpired checks if the device code has come to pass at time, now.
+func (d DeviceCode) HasExpired(now time.Time) bool {
+	return !now.Before(d.ExpiresAt)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Impersonation is a session in which an ADMIN acts as another user (e.g. to reproduce what an agent or merchant sees).
+// A zero EndedAt means the session has not ended.
+type Impersonation struct {
+	Id        string    `json:"id"`
+	AdminId   string    `json:"adminId"`
+	UserId    string    `json:"userId"`
+	Reason    string    `json:"reason"`
+	StartedAt time.Time `json:"startedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	EndedAt   time.Time `json:"endedAt"`
+}
+
+// HasEnded checks if the session was ended or has come to pass at time, now.
+func (i Impersonation) HasEnded(now time.Time) bool {
+	return !i.EndedAt.IsZero() || !now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Organization is a tenant of the service, e.g. a PASSER merchant, owning the accounts of its staff and agents.
+type Organization struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Domain    string    `json:"domain"`
+	OwnerId   string    `json:"ownerId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Membership binds a user to an organization, with the roles the user holds within the organization only.
+// A user is a member of one organization at most.
+type Membership struct {
+	OrgId    string    `json:"orgId"`
+	UserId   string    `json:"userId"`
+	Roles    []string  `json:"roles"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
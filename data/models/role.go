@@ -0,0 +1,64 @@
+package models
+
+// Permission is an operation a role can be granted, named as <resource>:<action>.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// The permission catalog.
+const (
+	PermUsersRead        = "users:read"
+	PermUsersWrite       = "users:write"
+	PermUsersImpersonate = "users:impersonate"
+	PermRolesRead        = "roles:read"
+	PermRolesWrite       = "roles:write"
+	PermOrgsRead         = "orgs:read"
+	PermOrgsWrite        = "orgs:write"
+	PermMembersRead      = "members:read"
+	PermMembersWrite     = "members:write"
+	PermParcelsRead      = "parcels:read"
+	PermParcelsWrite     = "parcels:write"
+	PermParcelsCollect   = "parcels:collect"
+)
+
+// Permissions is the permission catalog, i.e. all the permissions a role can be granted.
+var Permissions = []Permission{
+	{Name: PermUsersRead, Description: "list and view the user accounts"},
+	{Name: PermUsersWrite, Description: "add, update and remove the user accounts"},
+	{Name: PermUsersImpersonate, Description: "act as another user, for support"},
+	{Name: PermRolesRead, Description: "list and view the roles"},
+	{Name: PermRolesWrite, Description: "add, update and remove the roles"},
+	{Name: PermOrgsRead, Description: "list and view the organizations"},
+	{Name: PermOrgsWrite, Description: "add the organizations"},
+	{Name: PermMembersRead, Description: "list and view the user accounts of the own organization"},
+	{Name: PermMembersWrite, Description: "add, update and remove the user accounts of the own organization"},
+	{Name: PermParcelsRead, Description: "view the parcels"},
+	{Name: PermParcelsWrite, Description: "create and update the parcel jobs"},
+	{Name: PermParcelsCollect, Description: "collect the parcels from the locker stations"},
+}
+
+// IsPermission checks if the name is in the permission catalog.
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleAdmin is the role of the PASSER support staff. It cannot be updated or removed, so the service cannot be locked out.
+const RoleAdmin = "ADMIN"
+
+// RoleMerchantOwner is the role, within the organization, of the owner of a merchant organization.
+const RoleMerchantOwner = "MERCHANT_OWNER"
+
+// Role is a named set of permissions, assigned to the users.
+// A role also has the permissions of the roles it inherits.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits"`
+}
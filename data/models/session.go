@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Session is a login of a user through '/auth', i.e. the token issued, with the device it was issued to.
+// A zero RevokedAt means the session has not been revoked.
+type Session struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"userId"`
+	UserAgent  string    `json:"userAgent"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	RevokedAt  time.Time `json:"revokedAt"`
+}
+
+// IsActive checks if the session has neither been revoked nor come to pass at time, now.
+func (s Session) IsActive(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Token purposes.
+const (
+	PurposePasswordReset     = "PASSWORD_RESET"
+	PurposeEmailVerification = "EMAIL_VERIFICATION"
+)
+
+// Token is a single-use token (e.g. a password reset token) issued to a user.
+// Only the hash of the token is kept; the raw token is only known to its recipient.
+type Token struct {
+	Hash      string    `json:"-"`
+	Purpose   string    `json:"purpose"`
+	UserId    string    `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// HasExpired checks if the token has come to pass at time, now.
+func (t Token) HasExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
@@ -12,6 +12,8 @@ type User struct {
 	Name     Name     `json:"name"`
 	IsActive bool     `json:"isActive"`
 	Roles    []string `json:"roles"`
+	// a self-registered account waiting for the confirmation of its email (see users.Registration).
+	PendingVerification bool `json:"pendingVerification,omitempty"`
 }
 
 type Name struct {
@@ -0,0 +1,191 @@
+package data
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrOrganizationNotFound error = errors.New("[Organizations]: organization not found")
+	ErrMembershipNotFound   error = errors.New("[Organizations]: user is not a member of any organization")
+	ErrAlreadyMember        error = errors.New("[Organizations]: user is already a member of an organization")
+)
+
+// OrganizationStore is the in-memory data store of the organizations, keyed by the organization id,
+// and of their memberships, keyed by the user id.
+type OrganizationStore struct {
+	mu          sync.RWMutex
+	orgs        *avl.AVL
+	memberships *avl.AVL
+}
+
+// NewOrganizationStore instantiates an empty OrganizationStore.
+func NewOrganizationStore() *OrganizationStore {
+	return &OrganizationStore{orgs: avl.New(), memberships: avl.New()}
+}
+
+// Insert adds the organization to the store.
+func (s *OrganizationStore) Insert(o models.Organization) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.orgs.InsertNode(o, o.Id)
+}
+
+// Find returns the organization with the id.
+func (s *OrganizationStore) Find(id string) (models.Organization, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.orgs.Find(id)
+	if found == nil {
+		return models.Organization{}, ErrOrganizationNotFound
+	}
+
+	return found.GetItem().(models.Organization), nil
+}
+
+// ListAll returns all the organizations, in ascending id order.
+func (s *OrganizationStore) ListAll() []models.Organization {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.orgs.ListAllNodes(&st)
+
+	orgs := make([]models.Organization, st.GetSize())
+	for i := len(orgs) - 1; i >= 0; i-- {
+		item, _ := st.Pop()
+		orgs[i] = item.(models.Organization)
+	}
+
+	return orgs
+}
+
+// Join adds the membership of the user to the organization.
+func (s *OrganizationStore) Join(m models.Membership) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.orgs.Find(m.OrgId) == nil {
+		return ErrOrganizationNotFound
+	}
+	if s.memberships.Find(m.UserId) != nil {
+		return ErrAlreadyMember
+	}
+
+	return s.memberships.InsertNode(m, m.UserId)
+}
+
+// Update replaces the roles of the user in the organization the user is a member of.
+func (s *OrganizationStore) Update(userId string, roles []string) (models.Membership, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.memberships.Find(userId)
+	if found == nil {
+		return models.Membership{}, ErrMembershipNotFound
+	}
+
+	m := found.GetItem().(models.Membership)
+	m.Roles = roles
+	s.memberships.Update(userId, m)
+
+	return m, nil
+}
+
+// Leave removes the membership of the user.
+func (s *OrganizationStore) Leave(userId string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.memberships.Find(userId) == nil {
+		return ErrMembershipNotFound
+	}
+
+	return s.memberships.Remove(userId)
+}
+
+// MembershipOf returns the membership of the user.
+func (s *OrganizationStore) MembershipOf(userId string) (models.Membership, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.memberships.Find(userId)
+	if found == nil {
+		return models.Membership{}, ErrMembershipNotFound
+	}
+
+	return found.GetItem().(models.Membership), nil
+}
+
+// Members returns the memberships of the organization, in ascending user id order.
+func (s *OrganizationStore) Members(orgId string) []models.Membership {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.memberships.ListAllNodes(&st)
+
+	members := []models.Membership{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		m := item.(models.Membership)
+		if m.OrgId == orgId {
+			members = append([]models.Membership{m}, members...)
+		}
+	}
+
+	return members
+}
+
+// AssignsRole checks if the role is held by any member of any organization.
+func (s *OrganizationStore) AssignsRole(role string) bool {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.memberships.ListAllNodes(&st)
+
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		for _, r := range item.(models.Membership).Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ClaimsOf returns the 'org' and 'perms' claims of the tokens issued to the user: the organization the user is a member of, if any,
+// and the permissions of the user's roles together with the user's roles within the organization.
+// The organization store can be nil, i.e. no user is a member of an organization.
+func ClaimsOf(u models.User, roles *RoleStore, orgs *OrganizationStore) (string, []string) {
+
+	if orgs == nil {
+		return "", roles.Permissions(u.Roles)
+	}
+
+	m, err := orgs.MembershipOf(u.Id)
+	if err != nil {
+		return "", roles.Permissions(u.Roles)
+	}
+
+	all := append(append([]string{}, u.Roles...), m.Roles...)
+	return m.OrgId, roles.Permissions(all)
+}
@@ -0,0 +1,222 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrRoleNotFound       error = errors.New("[Roles]: role not found")
+	ErrUnknownPermission  error = errors.New("[Roles]: permission is not in the catalog")
+	ErrUnknownParentRole  error = errors.New("[Roles]: inherited role not found")
+	ErrRoleInheritsItself error = errors.New("[Roles]: role inheritance must not form a cycle")
+)
+
+// RoleStore is the in-memory data store of the roles, keyed by the role name.
+type RoleStore struct {
+	mu  sync.RWMutex
+	avl *avl.AVL
+}
+
+// NewRoleStore instantiates an empty RoleStore.
+func NewRoleStore() *RoleStore {
+	return &RoleStore{avl: avl.New()}
+}
+
+// Insert adds the role to the store, after checking its permissions and inherited roles.
+func (s *RoleStore) Insert(r models.Role) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.check(r)
+	if err != nil {
+		return err
+	}
+
+	return s.avl.InsertNode(r, r.Name)
+}
+
+// Update replaces the role with the same name, after checking its permissions and inherited roles.
+func (s *RoleStore) Update(r models.Role) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.avl.Find(r.Name) == nil {
+		return ErrRoleNotFound
+	}
+
+	err := s.check(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.avl.Update(r.Name, r)
+	return err
+}
+
+// Remove removes the role with the name. The roles inheriting it no longer do.
+func (s *RoleStore) Remove(name string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.avl.Find(name) == nil {
+		return ErrRoleNotFound
+	}
+
+	err := s.avl.Remove(name)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range s.list() {
+		inherits := []string{}
+		for _, parent := range r.Inherits {
+			if parent != name {
+				inherits = append(inherits, parent)
+			}
+		}
+		if len(inherits) != len(r.Inherits) {
+			r.Inherits = inherits
+			s.avl.Update(r.Name, r)
+		}
+	}
+
+	return nil
+}
+
+// Find returns the role with the name.
+func (s *RoleStore) Find(name string) (models.Role, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.avl.Find(name)
+	if found == nil {
+		return models.Role{}, ErrRoleNotFound
+	}
+
+	return found.GetItem().(models.Role), nil
+}
+
+// ListAll returns all the roles, in ascending name order.
+func (s *RoleStore) ListAll() []models.Role {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.list()
+}
+
+// Permissions returns the permissions, sorted, of the roles, including the permissions of the roles they inherit.
+// Unknown roles are ignored.
+func (s *RoleStore) Permissions(roles []string) []string {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	perms := map[string]bool{}
+	visited := map[string]bool{}
+	for _, name := range roles {
+		s.collect(name, perms, visited)
+	}
+
+	rtn := make([]string, 0, len(perms))
+	for p := range perms {
+		rtn = append(rtn, p)
+	}
+	sort.Strings(rtn)
+
+	return rtn
+}
+
+// collect adds the permissions of the role, and of the roles it inherits, to perms. The caller must hold the lock.
+func (s *RoleStore) collect(name string, perms map[string]bool, visited map[string]bool) {
+
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+
+	found := s.avl.Find(name)
+	if found == nil {
+		return
+	}
+
+	r := found.GetItem().(models.Role)
+	for _, p := range r.Permissions {
+		perms[p] = true
+	}
+	for _, parent := range r.Inherits {
+		s.collect(parent, perms, visited)
+	}
+}
+
+// check checks that the permissions of the role are in the catalog, and that the inherited roles exist without forming a cycle.
+// The caller must hold the lock.
+func (s *RoleStore) check(r models.Role) error {
+
+	for _, p := range r.Permissions {
+		if !models.IsPermission(p) {
+			return ErrUnknownPermission
+		}
+	}
+
+	for _, parent := range r.Inherits {
+		if parent == r.Name {
+			return ErrRoleInheritsItself
+		}
+		if s.avl.Find(parent) == nil {
+			return ErrUnknownParentRole
+		}
+		if s.inherits(parent, r.Name, map[string]bool{}) {
+			return ErrRoleInheritsItself
+		}
+	}
+
+	return nil
+}
+
+// inherits checks if the role with the name inherits (directly or not) the ancestor. The caller must hold the lock.
+func (s *RoleStore) inherits(name string, ancestor string, visited map[string]bool) bool {
+
+	if visited[name] {
+		return false
+	}
+	visited[name] = true
+
+	found := s.avl.Find(name)
+	if found == nil {
+		return false
+	}
+
+	for _, parent := range found.GetItem().(models.Role).Inherits {
+		if parent == ancestor || s.inherits(parent, ancestor, visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// list returns all the roles, in ascending name order. The caller must hold the lock.
+func (s *RoleStore) list() []models.Role {
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	roles := make([]models.Role, st.GetSize())
+	for i := len(roles) - 1; i >= 0; i-- {
+		item, _ := st.Pop()
+		roles[i] = item.(models.Role)
+	}
+
+	return roles
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrSessionNotFound error = errors.New("[Sessions]: session not found")
+)
+
+// SessionStore is the in-memory data store of the sessions, keyed by the session id.
+type SessionStore struct {
+	mu  sync.RWMutex
+	avl *avl.AVL
+}
+
+// NewSessionStore instantiates an empty SessionStore.
+func NewSessionStore() *SessionStore {
+	return &SessionStore{avl: avl.New()}
+}
+
+// Insert adds the session to the store.
+func (s *SessionStore) Insert(session models.Session) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.avl.InsertNode(session, session.Id)
+}
+
+// Find returns the session with the id.
+func (s *SessionStore) Find(id string) (models.Session, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	return found.GetItem().(models.Session), nil
+}
+
+// ListByUser returns the sessions of the user that are active at time, now, in ascending id order.
+func (s *SessionStore) ListByUser(userId string, now time.Time) []models.Session {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	sessions := []models.Session{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		session := item.(models.Session)
+		if session.UserId == userId && session.IsActive(now) {
+			sessions = append([]models.Session{session}, sessions...)
+		}
+	}
+
+	return sessions
+}
+
+// Touch records the activity of the session with the id, at time, now.
+func (s *SessionStore) Touch(id string, now time.Time) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return
+	}
+
+	session := found.GetItem().(models.Session)
+	session.LastSeenAt = now
+	s.avl.Update(id, session)
+}
+
+// Revoke revokes the active session with the id, of the user, at time, now.
+func (s *SessionStore) Revoke(id string, userId string, now time.Time) (models.Session, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.avl.Find(id)
+	if found == nil {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	session := found.GetItem().(models.Session)
+	if session.UserId != userId || !session.IsActive(now) {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	session.RevokedAt = now
+	s.avl.Update(id, session)
+	return session, nil
+}
+
+// RemoveInactive removes the sessions that have been revoked or have come to pass at time, now,
+// as their tokens are refused anyway (expired or revoked).
+func (s *SessionStore) RemoveInactive(now time.Time) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := stack.New()
+	s.avl.ListAllNodes(&st)
+
+	ids := []string{}
+	for st.GetSize() > 0 {
+		item, _ := st.Pop()
+		session := item.(models.Session)
+		if !session.IsActive(now) {
+			ids = append(ids, session.Id)
+		}
+	}
+
+	for _, id := range ids {
+		s.avl.Remove(id)
+	}
+
+	return len(ids)
+}
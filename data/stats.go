@@ -0,0 +1,68 @@
+package data
+
+import "github.com/go-qiu/passer-auth-service/data/avl"
+
+// Stats are the statistics of a store, for the monitoring of the service.
+type Stats struct {
+	Size   int
+	Height int
+}
+
+// statsOf returns the statistics of the avl tree.
+func statsOf(tree *avl.AVL) Stats {
+	return Stats{Size: tree.Size(), Height: tree.Height()}
+}
+
+// Stats returns the number of users and the height of the avl tree of the data store.
+func (ds *DataStore) Stats() Stats {
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return statsOf(ds.avl)
+}
+
+// Stats returns the number of sessions and the height of the avl tree of the store.
+func (s *SessionStore) Stats() Stats {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return statsOf(s.avl)
+}
+
+// Stats returns the number of API keys and the height of the avl tree of the store.
+func (s *APIKeyStore) Stats() Stats {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return statsOf(s.avl)
+}
+
+// Stats returns the number of delegations and the height of the avl tree of the store.
+func (s *DelegationStore) Stats() Stats {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return statsOf(s.avl)
+}
+
+// Stats returns the number of impersonation sessions and the height of the avl tree of the store.
+func (s *ImpersonationStore) Stats() Stats {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return statsOf(s.avl)
+}
+
+// Stats returns the number of single-use tokens and the height of the avl tree of the store.
+func (s *TokenStore) Stats() Stats {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return statsOf(s.avl)
+}
@@ -3,6 +3,7 @@ package data
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/go-qiu/passer-auth-service/data/avl"
 	"github.com/go-qiu/passer-auth-service/data/models"
@@ -11,13 +12,14 @@ import (
 
 var (
 	ErrEmptyTree             error = errors.New("[AVL]: tree is empty")
-	ErrNodeNotFound          error = errors.New("[AVL]: node not found")
-	ErrDuplicatedNode        error = errors.New("[AVL]: found duplicated parcel job record")
+	ErrNodeNotFound          error = avl.ErrNodeNotFound
+	ErrDuplicatedNode        error = avl.ErrDuplicatedNode
 	ErrEmptyNodeItemStatus   error = errors.New("[AVL]: item status code cannot be empty")
 	ErrInvalidNodeItemStatus error = errors.New("[AVL]: item status code is invalid")
 )
 
 type DataStore struct {
+	mu  sync.RWMutex
 	avl *avl.AVL
 }
 
@@ -27,6 +29,9 @@ func New() *DataStore {
 
 func (ds *DataStore) InsertNode(item models.User, id string) error {
 
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	err := ds.avl.InsertNode(item, id)
 	if err != nil {
 		return err
@@ -38,6 +43,9 @@ func (ds *DataStore) InsertNode(item models.User, id string) error {
 
 func (ds *DataStore) ListAllNodes(s *stack.Stack, requireDesc bool) error {
 
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
 	err := ds.avl.ListAllNodes(s)
 	if err != nil {
 		return err
@@ -61,6 +69,10 @@ func (ds *DataStore) ListAllNodes(s *stack.Stack, requireDesc bool) error {
 
 // wrapper function to find a specific data point by id
 func (ds *DataStore) Find(id string) (*avl.BinaryNode, error) {
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
 	found := ds.avl.Find(id)
 	if found == nil {
 		// not found
@@ -73,6 +85,9 @@ func (ds *DataStore) Find(id string) (*avl.BinaryNode, error) {
 // wrapper function to remove a specific data point by id (i.e. email)
 func (ds *DataStore) Remove(id string) error {
 
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	err := ds.avl.Remove(id)
 	if err != nil {
 		return err
@@ -83,6 +98,9 @@ func (ds *DataStore) Remove(id string) error {
 
 func (ds *DataStore) Update(id string, updated interface{}) (interface{}, error) {
 
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	u, err := ds.avl.Update(id, updated)
 	if err != nil {
 		return models.User{}, err
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+)
+
+var (
+	ErrTokenNotFound error = errors.New("[Tokens]: token not found")
+	ErrTokenExpired  error = errors.New("[Tokens]: token has expired")
+)
+
+// TokenStore is the in-memory data store of the single-use tokens, keyed by the token hash.
+type TokenStore struct {
+	mu  sync.Mutex
+	avl *avl.AVL
+}
+
+// NewTokenStore instantiates an empty TokenStore.
+func NewTokenStore() *TokenStore {
+	return &TokenStore{avl: avl.New()}
+}
+
+// Insert adds the token to the store.
+func (ts *TokenStore) Insert(t models.Token) error {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.avl.InsertNode(t, t.Hash)
+}
+
+// Consume removes the token matching hash and purpose from the store and returns it.
+// A token can only be consumed once; an expired token is removed but not returned.
+func (ts *TokenStore) Consume(hash string, purpose string) (models.Token, error) {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	found := ts.avl.Find(hash)
+	if found == nil {
+		return models.Token{}, ErrTokenNotFound
+	}
+
+	t := found.GetItem().(models.Token)
+	if t.Purpose != purpose {
+		// a token issued for another purpose is left untouched.
+		return models.Token{}, ErrTokenNotFound
+	}
+
+	err := ts.avl.Remove(hash)
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	if t.HasExpired(time.Now()) {
+		return models.Token{}, ErrTokenExpired
+	}
+
+	return t, nil
+}
+
+// RemoveAll removes all the tokens of the given purpose issued to the user.
+// Tokens that have expired are swept away at the same time.
+func (ts *TokenStore) RemoveAll(userId string, purpose string) {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	s := stack.New()
+	ts.avl.ListAllNodes(&s)
+
+	now := time.Now()
+	for s.GetSize() > 0 {
+		item, _ := s.Pop()
+		t := item.(models.Token)
+		if (t.UserId == userId && t.Purpose == purpose) || t.HasExpired(now) {
+			ts.avl.Remove(t.Hash)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-qiu/passer-auth-service/data/avl"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+	"github.com/go-qiu/passer-auth-service/tracing"
+)
+
+// the calls of the data store, recorded as the spans of the trace of the request (see package tracing).
+
+// startSpan starts the span of the call of the data store, op.
+func startSpan(ctx context.Context, op string) *tracing.Span {
+	_, span := tracing.Start(ctx, "DataStore."+op)
+	return span
+}
+
+// endSpan ends the span with the outcome of the call. A record not found is an outcome, not a failure.
+func endSpan(span *tracing.Span, err error) {
+
+	if errors.Is(err, ErrNodeNotFound) {
+		span.SetAttribute("store.found", false)
+	} else {
+		span.SetError(err)
+	}
+
+	span.End()
+}
+
+// InsertNodeContext is InsertNode, recorded as a span of the trace of ctx.
+func (ds *DataStore) InsertNodeContext(ctx context.Context, item models.User, id string) error {
+
+	span := startSpan(ctx, "InsertNode")
+	err := ds.InsertNode(item, id)
+	endSpan(span, err)
+
+	return err
+}
+
+// ListAllNodesContext is ListAllNodes, recorded as a span of the trace of ctx.
+func (ds *DataStore) ListAllNodesContext(ctx context.Context, s *stack.Stack, requireDesc bool) error {
+
+	span := startSpan(ctx, "ListAllNodes")
+	err := ds.ListAllNodes(s, requireDesc)
+	span.SetAttribute("store.count", s.GetSize())
+	endSpan(span, err)
+
+	return err
+}
+
+// FindContext is Find, recorded as a span of the trace of ctx.
+func (ds *DataStore) FindContext(ctx context.Context, id string) (*avl.BinaryNode, error) {
+
+	span := startSpan(ctx, "Find")
+	found, err := ds.Find(id)
+	endSpan(span, err)
+
+	return found, err
+}
+
+// RemoveContext is Remove, recorded as a span of the trace of ctx.
+func (ds *DataStore) RemoveContext(ctx context.Context, id string) error {
+
+	span := startSpan(ctx, "Remove")
+	err := ds.Remove(id)
+	endSpan(span, err)
+
+	return err
+}
+
+// UpdateContext is Update, recorded as a span of the trace of ctx.
+func (ds *DataStore) UpdateContext(ctx context.Context, id string, updated interface{}) (interface{}, error) {
+
+	span := startSpan(ctx, "Update")
+	u, err := ds.Update(id, updated)
+	endSpan(span, err)
+
+	return u, err
+}
@@ -2,22 +2,17 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 
+	"github.com/go-qiu/passer-auth-service/audit"
 	"github.com/go-qiu/passer-auth-service/data"
-	"github.com/go-qiu/passer-auth-service/data/models"
-	"github.com/go-qiu/passer-auth-service/jwt"
-	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/tracing"
+	"github.com/go-qiu/passer-auth-service/users"
 )
 
-var ErrEnvNotLoaded = errors.New("[JWT]: fail to load the env file")
-var ErrPayloadParsing = errors.New("[JWT]: fail to parse payload")
-
 // paramsAuth type struct is used for unmarshalling
 // the json send via the request body sent to the
 // the endpoint, '/auth'.
@@ -26,68 +21,41 @@ type paramsAuth struct {
 	Pw    string `json:"pw"`
 }
 
-// function to execute the authentication check
+// function to execute the authentication check.
+// The credentials are checked with users.CheckCredentials, so the response time
+// does not reveal the registered emails. The attempt is recorded in the audit log.
 func execAuth(ds *data.DataStore, r *http.Request) (string, error) {
 
+	ctx, span := tracing.Start(r.Context(), "execAuth")
+	defer span.End()
+
 	var params paramsAuth
 	b, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Warn("[Auth]: fail to read the request body", logging.FieldError, err)
 		return "", err
 	}
 	err = json.Unmarshal(b, &params)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Warn("[Auth]: fail to parse the request body", logging.FieldError, err)
 		return "", err
 	}
 
-	// (*w).Header().Set("Content-Type", "application/json")
-	found, err := ds.Find(params.Email)
+	user, err := users.CheckCredentials(ctx, ds, params.Email, params.Pw)
+	span.SetAttribute("auth.success", err == nil)
 	if err != nil {
+		middlewares.AuditAs(r, params.Email, audit.ActionLogin, params.Email, audit.OutcomeFailure)
 		return "", ErrAuthFail
 	}
+	middlewares.AuditAs(r, user.Id, audit.ActionLogin, user.Id, audit.OutcomeSuccess)
 
-	// found.
-	user := found.GetItem()
-	err = bcrypt.CompareHashAndPassword([]byte(user.(models.User).PwHash), []byte(params.Pw))
+	// credentials match
+	userJsonString, err := user.ToJson(false)
 	if err != nil {
-		// pwhash does not match.
-		return "", ErrAuthFail
-	} else {
-		// pwhash matches
-		userJsonString, err := user.(models.User).ToJson(false)
-		if err != nil {
-			return "", err
-		}
-
-		return userJsonString, nil
-	}
-}
-
-// generateJWT will generate a JWT using the header and payload passed in.
-func generateJWT(payload jwt.JWTPayload) (string, error) {
-
-	// get .env values
-	err := godotenv.Load()
-	if err != nil {
-		return "", ErrEnvNotLoaded
-	}
-	JWT_SECRET_KEY := os.Getenv("JWT_SECRET_KEY")
-
-	header := `{
-		"alg": "SHA512",
-		"typ" : "JWT"
-	}`
-
-	// convert payload data to json string
-	pl, err := json.Marshal(payload)
-	if err != nil {
-		return "", ErrPayloadParsing
+		return "", err
 	}
 
-	token := jwt.Generate(header, string(pl), JWT_SECRET_KEY)
-
-	return token, nil
+	return userJsonString, nil
 }
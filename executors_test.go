@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/helpers"
+)
+
+// timeAuth measures the duration of an execAuth call with the email and pw passed in.
+func timeAuth(ds *data.DataStore, email string, pw string) (time.Duration, error) {
+
+	body := fmt.Sprintf(`{"email": "%s", "pw": "%s"}`, email, pw)
+	r := httptest.NewRequest("POST", "/auth", bytes.NewBufferString(body))
+
+	start := time.Now()
+	_, err := execAuth(ds, r)
+	return time.Since(start), err
+}
+
+// percentile returns the p-th (0 to 1) percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+// TestExecAuthTiming checks that the response time of execAuth does not reveal
+// whether the email is registered, i.e. the timing distributions of a wrong
+// password for a registered email and of an unknown email are indistinguishable.
+func TestExecAuthTiming(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("timing measurement skipped in short mode")
+	}
+
+	ds := data.New()
+	userList, err := helpers.Preload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range userList {
+		ds.InsertNode(u, u.Email)
+	}
+
+	const samples = 300
+	known := make([]time.Duration, 0, samples)
+	unknown := make([]time.Duration, 0, samples)
+
+	// the samples are interleaved, so drifts in the machine load affect both distributions alike.
+	for i := 0; i < samples; i++ {
+		d, err := timeAuth(ds, "xy.lim@bestbuy.com", "wrong.password")
+		if err != ErrAuthFail {
+			t.Fatalf("registered email with wrong password: want %v, got %v", ErrAuthFail, err)
+		}
+		known = append(known, d)
+
+		d, err = timeAuth(ds, "no.such.user@bestbuy.com", "wrong.password")
+		if err != ErrAuthFail {
+			t.Fatalf("unknown email: want %v, got %v", ErrAuthFail, err)
+		}
+		unknown = append(unknown, d)
+	}
+
+	sort.Slice(known, func(i, j int) bool { return known[i] < known[j] })
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i] < unknown[j] })
+
+	// the interquartile ranges must overlap and the medians must be within 25% of each other.
+	// without the dummy hash, the unknown email path is orders of magnitude faster.
+	if percentile(unknown, 0.75) < percentile(known, 0.25) || percentile(known, 0.75) < percentile(unknown, 0.25) {
+		t.Errorf("interquartile ranges do not overlap: registered [%v, %v], unknown [%v, %v]",
+			percentile(known, 0.25), percentile(known, 0.75), percentile(unknown, 0.25), percentile(unknown, 0.75))
+	}
+
+	medianKnown := float64(percentile(known, 0.5))
+	medianUnknown := float64(percentile(unknown, 0.5))
+	ratio := medianUnknown / medianKnown
+	if ratio < 0.8 || ratio > 1.25 {
+		t.Errorf("median response times differ: registered %v, unknown %v", time.Duration(medianKnown), time.Duration(medianUnknown))
+	}
+}
@@ -5,14 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
 	"time"
 
+	"github.com/go-qiu/passer-auth-service/data"
 	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
 	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/tracing"
 	"github.com/go-qiu/passer-auth-service/users"
-	"github.com/joho/godotenv"
 )
 
 var (
@@ -21,39 +23,32 @@ var (
 	ErrUserExisted             error = errors.New("[API-Users]: user already existed")
 )
 
+// cookieSession is the response of '/auth?mode=cookie'.
+type cookieSession struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CSRFToken string    `json:"csrfToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 // Auth is a http handler for the 'POST' request to authenticate the user credentials, passed in via the request body.
+// With '?mode=cookie', the token is set in a session cookie instead of being returned (see middlewares.SetSessionCookies).
 func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 
-	// get .env values
-	err := godotenv.Load()
-	if err != nil {
-		errString := "[JWT]: fail to load .env"
-		a.errorLog.Println(errString)
-		msg := fmt.Sprintf(`{
-			"ok" : false,
-			"msg" : "%s",
-			"data" : {}
-		}`, errString)
-		a.clientError(w, http.StatusInternalServerError, msg)
-		return
-	}
-	JWT_ISSUER := os.Getenv("JWT_ISSUER")
+	ctx, span := tracing.Start(r.Context(), "Auth")
+	r = r.WithContext(ctx)
 
-	JWT_EXP_MINUTES, err := strconv.Atoi(os.Getenv("JWT_EXP_MINUTES"))
-	if err != nil {
-		errString := "[JWT]: fail to load .env"
-		a.errorLog.Println(errString)
-		msg := fmt.Sprintf(`{
-			"ok" : false,
-			"msg" : "%s",
-			"data" : {}
-		}`, errString)
-		a.clientError(w, http.StatusInternalServerError, msg)
-		return
-	}
+	// the outcome of the attempt, for the metrics and the trace.
+	result := metrics.AuthError
+	defer func() {
+		metrics.AuthAttempts.Inc(result)
+		span.SetAttribute("auth.outcome", result)
+		span.End()
+	}()
 
 	// Only allow a 'POST' requst to continue.
 	if r.Method != http.MethodPost {
+		result = metrics.AuthMethodNotAllowed
 
 		// not a 'POST' request
 		errString := fmt.Sprintf("[AUTH]: request method, '%s' is not allowed for this api endpoint", r.Method)
@@ -67,7 +62,9 @@ func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// ok. it is a 'POST' request.
+	result = metrics.AuthUnsupportedMediaType
 	if r.Header.Get("Content-Type") == "application/json" {
+		result = metrics.AuthError
 
 		// json data is in the request body.
 
@@ -79,12 +76,13 @@ func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			if err != ErrAuthFail {
 
-				a.serverError(w, err)
+				a.serverError(w, r, err)
 				return
 
 			} else {
 
 				// auth failure
+				result = metrics.AuthInvalidCredentials
 				msg := fmt.Sprintf(`{
 					"ok": false,
 					"msg": "[AUTH]: %s",
@@ -102,24 +100,36 @@ func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 		var foundUser models.User
 		err = json.Unmarshal([]byte(outcome), &foundUser)
 		if err != nil {
-			a.serverError(w, err)
+			a.serverError(w, r, err)
 			return
 
 		}
 
-		exp := time.Now().Add(time.Minute * time.Duration(JWT_EXP_MINUTES)).UnixMilli()
+		org, perms := data.ClaimsOf(foundUser, a.roles, a.orgs)
+		exp := time.Now().Add(a.config.JWTExp)
+
+		// track the session of the token, so the user can see and revoke it.
+		session, err := a.sessions.Start(foundUser.Id, r, exp)
+		if err != nil {
+			a.serverError(w, r, err)
+			return
+		}
+
 		name := fmt.Sprintf("%s %s", foundUser.Name.First, foundUser.Name.Last)
 		pl := jwt.JWTPayload{
 			Id:       foundUser.Email,
 			Name:     name,
 			Roles:    foundUser.Roles,
 			IsActive: foundUser.IsActive,
-			Iss:      JWT_ISSUER,
-			Exp:      exp,
+			Iss:      a.config.JWTIssuer,
+			Exp:      exp.UnixMilli(),
+			Perms:    perms,
+			Org:      org,
+			Jti:      session.Id,
 		}
 
 		var token string
-		token, err = generateJWT(pl)
+		token, err = jwt.Sign(pl, a.config.JWTSecretKey)
 		if err != nil {
 			msg := fmt.Sprintf(`{
 				"ok" : false,
@@ -131,6 +141,21 @@ func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// in the cookie session mode (e.g. of the web portal), the token is only set in an 'HttpOnly' cookie,
+		// so the scripts of the portal never handle it; they get the CSRF token of the session instead.
+		if r.URL.Query().Get("mode") == "cookie" {
+			csrfToken := middlewares.CSRFToken(a.config.JWTSecretKey, session.Id)
+			middlewares.SetSessionCookies(w, a.sessions.Cookies, token, csrfToken, exp)
+			result = metrics.AuthSuccess
+			helpers.WriteJSON(w, http.StatusOK, true, "[AUTH]: authentication successful", cookieSession{
+				Name:      name,
+				Email:     foundUser.Email,
+				CSRFToken: csrfToken,
+				ExpiresAt: exp,
+			})
+			return
+		}
+
 		msg := fmt.Sprintf(`{
 			"ok" : true,
 			"msg" : "[AUTH]: authentication successful",
@@ -141,6 +166,7 @@ func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 			}
 		}`, token, name, foundUser.Email)
 
+		result = metrics.AuthSuccess
 		bearerToken := fmt.Sprintf("Bearer %s", token)
 		w.Header().Set("Authorization", bearerToken)
 		fmt.Fprintln(w, msg)
@@ -153,7 +179,7 @@ func (a *application) Auth(w http.ResponseWriter, r *http.Request) {
 // the appropriate user data operations handler.
 func (a *application) Users(w http.ResponseWriter, r *http.Request) {
 
-	users.Handler(w, r, a.dataStore)
+	users.Handler(w, r, a.dataStore, a.roles)
 }
 
 // Verify method to verify the validity of a token.
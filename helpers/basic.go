@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"time"
+
 	"github.com/go-qiu/passer-auth-service/data/models"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -83,3 +85,136 @@ func Preload() ([]models.User, error) {
 
 	return users, nil
 }
+
+// PreloadClients create the OAuth 2.0 client data points for loading into the in-memory client store.
+// This is facilitate development and testing.
+// The secrets of the confidential clients are not preloaded: they are set from the configuration (see OAUTH_CLIENT_SECRETS).
+func PreloadClients() []models.Client {
+
+	clients := []models.Client{}
+
+	// merchant web portal. a confidential client, i.e. has a client secret.
+	cPortal := models.Client{
+		Id:           "merchant-portal",
+		Name:         "PASSER Merchant Portal",
+		RedirectURIs: []string{"https://localhost:8080/oauth/callback"},
+		Scopes:       []string{"openid", "profile", "email", "users:read", "users:write"},
+		GrantTypes:   []string{"authorization_code"},
+		IsPublic:     false}
+
+	clients = append(clients, cPortal)
+
+	// consumer mobile app. a public client, i.e. relies on PKCE only.
+	cMobile := models.Client{
+		Id:           "consumer-app",
+		Name:         "PASSER Mobile",
+		RedirectURIs: []string{"sg.passer.app:/oauth/callback"},
+		Scopes:       []string{"openid", "profile", "email", "parcels:collect"},
+		GrantTypes:   []string{"authorization_code"},
+		IsPublic:     true}
+
+	clients = append(clients, cMobile)
+
+	// locker station controller. a machine-to-machine client.
+	cLocker := models.Client{
+		Id:         "locker-station-01",
+		Name:       "PASSER Locker Station 01",
+		Scopes:     []string{"parcels:collect"},
+		GrantTypes: []string{"client_credentials"},
+		IsPublic:   false}
+
+	clients = append(clients, cLocker)
+
+	// merchant backend. a machine-to-machine client.
+	cBackend := models.Client{
+		Id:         "bestbuy-backend",
+		Name:       "BestBuy Backend",
+		Scopes:     []string{"users:read", "parcels:collect"},
+		GrantTypes: []string{"client_credentials", "urn:ietf:params:oauth:grant-type:token-exchange"},
+		Audiences:  []string{"passer-parcel-service"},
+		IsPublic:   false}
+
+	clients = append(clients, cBackend)
+
+	// locker station kiosk. a public client, signed in by an agent from the agent's phone.
+	cKiosk := models.Client{
+		Id:         "locker-kiosk-01",
+		Name:       "PASSER Locker Station 01 Kiosk",
+		Scopes:     []string{"openid", "profile", "parcels:collect"},
+		GrantTypes: []string{"urn:ietf:params:oauth:grant-type:device_code"},
+		IsPublic:   true}
+
+	clients = append(clients, cKiosk)
+
+	return clients
+}
+
+// PreloadRoles create the role data points for loading into the in-memory role store.
+// The roles are listed parents first, so they can be inserted in order.
+func PreloadRoles() []models.Role {
+
+	return []models.Role{
+		{
+			Name:        "CONSUMER",
+			Description: "a consumer receiving parcels",
+			Permissions: []string{models.PermParcelsRead},
+			Inherits:    []string{},
+		},
+		{
+			Name:        "AGENT",
+			Description: "an agent collecting parcels from the locker stations",
+			Permissions: []string{models.PermParcelsCollect},
+			Inherits:    []string{"CONSUMER"},
+		},
+		{
+			Name:        "MERCHANT",
+			Description: "a merchant sending parcels",
+			Permissions: []string{models.PermParcelsWrite},
+			Inherits:    []string{"CONSUMER"},
+		},
+		{
+			Name:        models.RoleMerchantOwner,
+			Description: "the owner of a merchant organization, managing its staff and agents",
+			Permissions: []string{models.PermMembersRead, models.PermMembersWrite},
+			Inherits:    []string{"MERCHANT", "AGENT"},
+		},
+		{
+			Name:        models.RoleAdmin,
+			Description: "the PASSER support staff",
+			Permissions: []string{
+				models.PermUsersRead,
+				models.PermUsersWrite,
+				models.PermUsersImpersonate,
+				models.PermRolesRead,
+				models.PermRolesWrite,
+				models.PermOrgsRead,
+				models.PermOrgsWrite,
+			},
+			Inherits: []string{"AGENT", "MERCHANT"},
+		},
+	}
+}
+
+// PreloadOrganizations create the merchant organization data points, with the memberships of their owners,
+// for loading into the in-memory organization store.
+func PreloadOrganizations() ([]models.Organization, []models.Membership) {
+
+	now := time.Now()
+
+	orgs := []models.Organization{
+		{Id: "bestbuy", Name: "BestBuy", Domain: "bestbuy.com", OwnerId: "xy.lim@bestbuy.com", CreatedAt: now},
+		{Id: "bismi", Name: "Bismi", Domain: "bismi.com", OwnerId: "azi.abdu@bismi.com", CreatedAt: now},
+	}
+
+	memberships := []models.Membership{}
+	for _, o := range orgs {
+		memberships = append(memberships, models.Membership{
+			OrgId:    o.Id,
+			UserId:   o.OwnerId,
+			Roles:    []string{models.RoleMerchantOwner},
+			JoinedAt: now,
+		})
+	}
+
+	return orgs, memberships
+}
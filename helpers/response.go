@@ -0,0 +1,26 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Response is the envelope of the json content returned by the api endpoints.
+type Response struct {
+	Ok   bool        `json:"ok"`
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
+}
+
+// WriteJSON sends the ok, msg and data values, wrapped in the Response envelope, to the requestor.
+// A nil data value is sent as an empty json object.
+func WriteJSON(w http.ResponseWriter, status int, ok bool, msg string, data interface{}) {
+
+	if data == nil {
+		data = struct{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Ok: ok, Msg: msg, Data: data})
+}
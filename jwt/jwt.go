@@ -5,6 +5,7 @@ package jwt
 
 import (
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -19,6 +20,13 @@ var ErrWrongFormat = errors.New("[JWT]: wrong token format")
 var ErrEmptyJWTHeader = errors.New("[JWT]: jwt header is empty")
 var ErrEmptyJWTPayload = errors.New("[JWT]: jwt payload is empty")
 var ErrEmptyJWTSignature = errors.New("[JWT]: jwt signature is empty")
+var ErrPayloadParsing = errors.New("[JWT]: fail to parse payload")
+
+// header is the first segment of the JWTs generated by Sign.
+const header = `{
+		"alg": "SHA512",
+		"typ" : "JWT"
+	}`
 
 // Generate creates a JWT JSON string using the parameters passed in.
 // Input parameters:
@@ -49,6 +57,22 @@ func Generate(header string, payload string, key string) string {
 	return token
 }
 
+// Sign generates a JWT with the payload, signed with the key.
+func Sign(payload JWTPayload, key string) (string, error) {
+
+	if strings.TrimSpace(key) == "" {
+		return "", ErrEmptyKey
+	}
+
+	// convert payload data to json string
+	pl, err := json.Marshal(payload)
+	if err != nil {
+		return "", ErrPayloadParsing
+	}
+
+	return Generate(header, string(pl), key), nil
+}
+
 // Verify uses the passed in jwt and key to execute a check on the integrity of the jwt.
 // Input parameters:
 // - jwt is a JSON string
@@ -71,7 +95,7 @@ func Verify(jwt string, key string) (bool, error) {
 
 	// split the token string (by '.')
 	ts := strings.Split(jwt, ".")
-	if len(ts) == 0 {
+	if len(ts) != 3 {
 		// jwt is not in the anticipated format of
 		// hhhhhhhhh.pppppppppp.sssssss
 		return false, ErrWrongFormat
@@ -99,7 +123,9 @@ func Verify(jwt string, key string) (bool, error) {
 	// check #1.
 	// is the signature segment of the jwt the same
 	// as the calculated signature.
-	if signatureB64 != ts[2] {
+	// compared in constant time, so the response time does not reveal
+	// how much of a forged signature is correct.
+	if subtle.ConstantTimeCompare([]byte(signatureB64), []byte(ts[2])) != 1 {
 		// not the same
 		return false, nil
 	}
@@ -113,6 +139,29 @@ func Verify(jwt string, key string) (bool, error) {
 	return true, nil
 }
 
+// Decode returns the payload of the jwt.
+// It does not check the integrity of the jwt; use Verify for that.
+func Decode(jwt string) (JWTPayload, error) {
+
+	ts := strings.Split(jwt, ".")
+	if len(ts) != 3 {
+		return JWTPayload{}, ErrWrongFormat
+	}
+
+	jsonString, err := base64.StdEncoding.DecodeString(ts[1])
+	if err != nil {
+		return JWTPayload{}, ErrPayloadParsing
+	}
+
+	var pl JWTPayload
+	err = json.Unmarshal(jsonString, &pl)
+	if err != nil {
+		return JWTPayload{}, ErrPayloadParsing
+	}
+
+	return pl, nil
+}
+
 // b64Encode execute base64 encoding of each element passed into it.
 // Input parameters:
 // - input ([][]byte) contains all the individual element ([]byte) that needs to be encoded into base64;
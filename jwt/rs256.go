@@ -0,0 +1,113 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+var ErrInvalidPEM = errors.New("[JWT]: fail to decode the pem encoded key")
+var ErrNotRSAKey = errors.New("[JWT]: key is not a RSA private key")
+
+// rs256Header is the first segment of the JWTs generated by SignRS256.
+type rs256Header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWK is a RSA public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517, section 5).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// SignRS256 generates a standard (RFC 7519) JWT, with the claims, signed with the RSA private key using RS256.
+// Unlike Generate, the segments are base64url encoded without padding, so the JWT can be verified by the common JWT libraries.
+func SignRS256(claims interface{}, key *rsa.PrivateKey, kid string) (string, error) {
+
+	h, err := json.Marshal(rs256Header{Alg: "RS256", Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+
+	pl, err := json.Marshal(claims)
+	if err != nil {
+		return "", ErrPayloadParsing
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(pl)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// NewJWK returns the public key of the RSA private key in the JWK format.
+func NewJWK(key *rsa.PrivateKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: KeyId(&key.PublicKey),
+		N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+	}
+}
+
+// KeyId returns the JWK thumbprint (RFC 7638) of the RSA public key, for use as its 'kid'.
+func KeyId(pub *rsa.PublicKey) string {
+
+	// the members are in lexicographic order, without whitespace.
+	thumbprint := `{"e":"` + base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()) +
+		`","kty":"RSA","n":"` + base64.RawURLEncoding.EncodeToString(pub.N.Bytes()) + `"}`
+
+	h := sha256.Sum256([]byte(thumbprint))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// ParseRSAPrivateKey parses a pem encoded RSA private key, in the PKCS #1 or PKCS #8 format.
+func ParseRSAPrivateKey(b []byte) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return key, nil
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrNotRSAKey
+	}
+
+	return rsaKey, nil
+}
@@ -1,5 +1,7 @@
 package jwt
 
+import "strings"
+
 // JWTPayload is the struct for holding the data used in generating the second segment of the JWT string.
 type JWTPayload struct {
 	Id       string   `json:"id"`
@@ -8,6 +10,74 @@ type JWTPayload struct {
 	IsActive bool     `json:"isActive"`
 	Iss      string   `json:"iss"`
 	Exp      int64    `json:"exp"`
+
+	// permissions of the roles assigned to the subject, resolved when the token is issued.
+	Perms []string `json:"perms,omitempty"`
+
+	// id of the organization the subject is a member of; the permissions include the subject's roles within the organization.
+	Org string `json:"org,omitempty"`
+
+	// OAuth 2.0 attributes; left out of the tokens issued by '/auth'.
+	Sub      string `json:"sub,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+
+	// token exchange (RFC 8693); the audience the token is restricted to and the party acting on behalf of the subject.
+	Aud string `json:"aud,omitempty"`
+	Act *Actor `json:"act,omitempty"`
+
+	// unique id of the token, for the tokens that can be revoked before they expire (e.g. impersonation).
+	Jti string `json:"jti,omitempty"`
+}
+
+// Actor is the 'act' (actor) claim of a delegated token (RFC 8693, section 4.1).
+// A chain of delegation is represented by nesting the prior actors.
+type Actor struct {
+	Sub string `json:"sub"`
+	Act *Actor `json:"act,omitempty"`
+}
+
+// Subject returns the id of the user (or client) the token was issued to.
+// The tokens issued by '/auth' only carry the 'id' attribute.
+func (p JWTPayload) Subject() string {
+	if p.Sub != "" {
+		return p.Sub
+	}
+	return p.Id
+}
+
+// HasRole checks if the role was assigned to the payload's subject.
+func (p JWTPayload) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks if the permission was granted to the payload's subject.
+// A client acting on its own behalf (i.e. client credentials) holds the permissions named by the scopes granted to its token.
+func (p JWTPayload) HasPermission(perm string) bool {
+	if p.ClientId != "" && p.Subject() == p.ClientId {
+		return p.HasScope(perm)
+	}
+	for _, v := range p.Perms {
+		if v == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope checks if the scope was granted to the payload's token.
+func (p JWTPayload) HasScope(scope string) bool {
+	for _, s := range strings.Fields(p.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 // JWTHeader is the struct for holding the data used in generating the first segment of the JWT string.
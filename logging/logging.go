@@ -0,0 +1,107 @@
+/*
+Package logging provides the structured logger of the service, which writes one JSON object per line (see log/slog).
+
+Every request gets its own logger (see middlewares.RequestID), carried by the context of the request,
+with the fields identifying the request (request id, route, client ip and, once authenticated, user id).
+The handlers log with FromContext, so all the lines of a request can be correlated.
+
+The values of the fields named after a secret (e.g. 'password', 'token') are redacted, so a secret is never logged.
+*/
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// the fields of the lines logged for a request.
+const (
+	FieldRequestID = "request_id"
+	FieldRoute     = "route"
+	FieldMethod    = "method"
+	FieldClientIP  = "client_ip"
+	FieldUserID    = "user_id"
+	FieldTraceID   = "trace_id"
+	FieldError     = "err"
+)
+
+// redacted replaces the value of the fields named after a secret.
+const redacted = "[REDACTED]"
+
+// secrets are the parts of the names of the fields holding a secret, in lower case.
+var secrets = []string{"password", "passwd", "pwd", "token", "secret", "authorization", "cookie", "csrf", "api_key", "apikey"}
+
+// New returns a logger writing the lines, in JSON, to w, from the level, which can be changed while the service runs.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact}))
+}
+
+// redact replaces the value of the fields holding a secret.
+func redact(groups []string, a slog.Attr) slog.Attr {
+
+	if isSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	return a
+}
+
+// isSecret checks if the field, named key, holds a secret.
+func isSecret(key string) bool {
+
+	key = strings.ToLower(key)
+	for _, secret := range secrets {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contextKey is the type of the key of the logger in the context of a request.
+type contextKey struct{}
+
+// requestLogger is the logger of a request. Its fields grow as the request is handled (e.g. the user id, once authenticated),
+// so the lines logged once the request is handled (e.g. the access log) carry them too.
+type requestLogger struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+}
+
+// NewContext returns a copy of ctx carrying the logger of a request.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestLogger{logger: logger})
+}
+
+// FromContext returns the logger of the request of ctx, or else the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+
+	rl, ok := ctx.Value(contextKey{}).(*requestLogger)
+	if !ok {
+		return slog.Default()
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return rl.logger
+}
+
+// With adds the fields (key-value pairs) to the logger of the request of ctx, for all the lines logged afterwards.
+// It does nothing when ctx carries no logger.
+func With(ctx context.Context, args ...interface{}) {
+
+	rl, ok := ctx.Value(contextKey{}).(*requestLogger)
+	if !ok {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.logger = rl.logger.With(args...)
+}
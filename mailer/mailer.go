@@ -0,0 +1,129 @@
+/*
+Package mailer delivers the emails (e.g. password reset links) sent by the service.
+The Mailer interface allows the delivery mechanism to be swapped, e.g. SMTP in deployment and a file (or stdout) in local testing.
+*/
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrEmptyRecipient = errors.New("[Mailer]: recipient cannot be empty")
+var ErrUnknownMailer = errors.New("[Mailer]: unknown mailer type")
+
+// Message is the email to be delivered.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by every email delivery mechanism.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer delivers the emails through a SMTP server.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP instantiates a SMTPMailer.
+// PLAIN auth is used when username is not empty.
+func NewSMTP(host string, port string, username string, password string, from string) *SMTPMailer {
+
+	m := &SMTPMailer{
+		addr: fmt.Sprintf("%s:%s", host, port),
+		from: from,
+	}
+
+	if strings.TrimSpace(username) != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+// Send delivers msg through the SMTP server.
+func (m *SMTPMailer) Send(msg Message) error {
+
+	if strings.TrimSpace(msg.To) == "" {
+		return ErrEmptyRecipient
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, compose(m.from, msg))
+}
+
+// FileMailer writes the emails to a file (or stdout).
+// It is meant for local development and testing.
+type FileMailer struct {
+	mu   sync.Mutex
+	from string
+	w    io.Writer
+}
+
+// NewFile instantiates a FileMailer that appends the emails to the file at path.
+// The emails are written to stdout when path is empty or "-".
+func NewFile(path string, from string) (*FileMailer, error) {
+
+	if strings.TrimSpace(path) == "" || path == "-" {
+		return &FileMailer{from: from, w: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{from: from, w: f}, nil
+}
+
+// Send writes msg to the file.
+func (m *FileMailer) Send(msg Message) error {
+
+	if strings.TrimSpace(msg.To) == "" {
+		return ErrEmptyRecipient
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "Date: %s\r\n%s\r\n", time.Now().Format(time.RFC1123Z), compose(m.from, msg))
+	return err
+}
+
+// New instantiates the Mailer named by kind ("smtp" or "file").
+func New(kind string, from string, smtpHost string, smtpPort string, smtpUsername string, smtpPassword string, filePath string) (Mailer, error) {
+
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "smtp":
+		return NewSMTP(smtpHost, smtpPort, smtpUsername, smtpPassword, from), nil
+	case "", "file":
+		return NewFile(filePath, from)
+	default:
+		return nil, ErrUnknownMailer
+	}
+}
+
+// compose formats msg as a RFC 822 email.
+func compose(from string, msg Message) []byte {
+
+	content := fmt.Sprintf("From: %s\r\n", from)
+	content += fmt.Sprintf("To: %s\r\n", msg.To)
+	content += fmt.Sprintf("Subject: %s\r\n", msg.Subject)
+	content += "MIME-Version: 1.0\r\n"
+	content += "Content-Type: text/plain; charset=\"utf-8\"\r\n"
+	content += "\r\n"
+	content += msg.Body + "\r\n"
+
+	return []byte(content)
+}
@@ -1,62 +1,136 @@
 package main
 
 import (
-	"log"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/config"
 	"github.com/go-qiu/passer-auth-service/data"
 	"github.com/go-qiu/passer-auth-service/helpers"
-	"github.com/joho/godotenv"
+	"github.com/go-qiu/passer-auth-service/logging"
 )
 
-var ds data.DataStore = *data.New()
+var ds *data.DataStore = data.New()
 
 func main() {
 
+	// 'verify-audit <file>' checks the chain of the audit log in the file, instead of running the service.
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		os.Exit(verifyAudit(os.Args[2:]))
+	}
+
 	// Simulate a data pull of PASSER Locker Station
 	// specific Parcel Job records from the HQ Data Center.
 	// The records are inserted into the local data store.
 
+	// declare the logger, in JSON. its level is set by the configuration.
+	// the lines of the standard logger (e.g. of the dependencies) go through it too.
+	logLevel := new(slog.LevelVar)
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+
 	userList, err := helpers.Preload()
 	if err != nil {
-		log.Println(err)
-		os.Exit(1)
+		fatal(logger, err)
 	}
 	for _, u := range userList {
 		ds.InsertNode(u, u.Email)
 	}
 
-	// declare custom loggers
-	infoLog := log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "[ERROR]\t", log.Ldate|log.Ltime|log.Lshortfile)
-
-	// get .env values
-	err = godotenv.Load()
+	// the stores outlive the reloads of the configuration.
+	st, err := newStores()
 	if err != nil {
-		errString := "[JWT]: fail to load .env"
-		errorLog.Fatalln(errString)
+		fatal(logger, err)
+	}
+
+	// load the configuration, and build the web application with it.
+	// the service does not start with a missing or invalid setting.
+	s := &server{stores: st, logger: logger, logLevel: logLevel}
+	s.config, err = config.NewHolder(os.Args[1:], s.apply)
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	}
-	addr := os.Getenv("SERVER_ADDR")
+	if err != nil {
+		fatal(logger, err)
+	}
+	cfg := s.config.Current()
+	s.registerStoreMetrics()
 
-	// declare and instantiate a web application
-	app := &application{
-		errorLog:  errorLog,
-		infoLog:   infoLog,
-		dataStore: &ds,
+	// record the security events in the audit log.
+	s.auditLog, err = audit.Open(cfg.AuditLogFile)
+	if err != nil {
+		fatal(logger, err)
 	}
+	audit.SetDefault(s.auditLog)
 
-	// declare and instantiate a custom http server
+	go s.app().impersonation.SweepExpired(time.Minute)
+	go s.app().sessions.SweepInactive(time.Minute)
+	go s.app().oauth.SweepExpired(time.Minute)
+	go s.app().delegations.SweepInactive(time.Minute)
+
+	// reload the configuration on SIGHUP, or when its files change.
+	go s.watch(cfg.WatchInterval)
+
+	// declare and instantiate a custom http server.
+	// the certificate is picked on every tls handshake, so a renewed certificate is served without a restart.
 	srv := &http.Server{
-		Addr:     addr,
-		ErrorLog: errorLog,
-		Handler:  app.routes(),
+		Addr:      cfg.ServerAddr,
+		ErrorLog:  slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		Handler:   s,
+		TLSConfig: &tls.Config{GetCertificate: s.config.GetCertificate},
+	}
+
+	// the metrics are scraped on their own listener, off the public https server.
+	metricsSrv := s.serveMetrics(cfg.MetricsAddr)
+
+	// shut down gracefully on SIGTERM or SIGINT, e.g. on a deploy.
+	stopped := make(chan struct{})
+	go func() {
+		s.shutdownOnSignal(srv)
+		close(stopped)
+	}()
+
+	logger.Info("[Server]: HTTPS Server started and listening", "addr", "https://"+cfg.ServerAddr)
+	err = srv.ListenAndServeTLS("", "")
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal(logger, err)
+	}
+
+	<-stopped
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+	logger.Info("[Server]: stopped")
+}
+
+// verifyAudit checks the chain of the audit log in the file of the arguments, args.
+// It returns the exit code of the command, i.e. 0 when the audit log is intact.
+func verifyAudit(args []string) int {
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: passer-auth-service verify-audit <file>")
+		return 2
 	}
 
-	infoLog.Printf("HTTPS Server started and listening on https://%s ...", addr)
-	err = srv.ListenAndServeTLS("./ssl/cert03.pem", "./ssl/key03.pem")
+	last, err := audit.VerifyFile(args[0])
 	if err != nil {
-		errorLog.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+
+	fmt.Printf("[Audit]: %s is intact. %d entries, last hash %s\n", args[0], last.Seq, last.Hash)
+	return 0
+}
+
+// fatal logs the error, which prevents the service from running, and exits.
+func fatal(logger *slog.Logger, err error) {
+	logger.Error("[Server]: fail to run", logging.FieldError, err)
+	os.Exit(1)
 }
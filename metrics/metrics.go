@@ -0,0 +1,287 @@
+/*
+Package metrics exposes the metrics of the service in the Prometheus text format (version 0.0.4), at '/metrics'
+on a listener of its own (METRICS_ADDR), off the public server.
+
+It implements the three kinds of metrics the service needs (counters, histograms and gauges read on scrape),
+with labels, on the standard library only. The metrics of the service are declared in service.go.
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of the buckets of the latency histograms, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family, written in the text format.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metrics exposed by the service.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default is the registry of the metrics of the service.
+var Default = &Registry{}
+
+func (reg *Registry) register(c collector) {
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, registered := range reg.collectors {
+		if registered.name() == c.name() {
+			panic(fmt.Sprintf("[Metrics]: metric %s is already registered", c.name()))
+		}
+	}
+
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Write writes all the metrics in the text format, sorted by name.
+func (reg *Registry) Write(w io.Writer) {
+
+	reg.mu.Lock()
+	collectors := append([]collector{}, reg.collectors...)
+	reg.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// ServeHTTP handles the scrape of the metrics.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	reg.Write(w)
+}
+
+// family holds the name, help and label names of a metric family.
+type family struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (f family) name() string { return f.metricName }
+
+func (f family) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, kind)
+}
+
+// key returns the key of the label values, checking that there is one value per label.
+func (f family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("[Metrics]: metric %s has %d labels, got %d values", f.metricName, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs returns the labels, with the values of the key and the extra label (e.g. 'le'), in the text format.
+func (f family) labelPairs(key string, extra ...string) string {
+
+	pairs := []string{}
+	if len(f.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escape(v, true)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1], true)))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys returns the keys of the values, sorted, so the output is stable.
+func sortedKeys(values map[string]float64) []string {
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CounterVec is a counter, partitioned by its labels.
+type CounterVec struct {
+	family
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+// NewCounterVec registers a counter with the labels in the registry.
+func (reg *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+
+	c := &CounterVec{family: family{metricName: name, help: help, labels: labels}, series: map[string]float64{}}
+	reg.register(c)
+
+	return c
+}
+
+// Inc increments the counter with the label values (one per label, in order).
+func (c *CounterVec) Inc(values ...string) {
+
+	key := c.key(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.series[key]++
+}
+
+func (c *CounterVec) write(w io.Writer) {
+
+	c.header(w, "counter")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelPairs(key), formatFloat(c.series[key]))
+	}
+}
+
+// HistogramVec is a histogram, partitioned by its labels.
+type HistogramVec struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulated.
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the buckets (upper bounds, ascending) and the labels in the registry.
+func (reg *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+
+	h := &HistogramVec{family: family{metricName: name, help: help, labels: labels}, buckets: buckets, series: map[string]*histogram{}}
+	reg.register(h)
+
+	return h
+}
+
+// Observe records the value with the label values (one per label, in order).
+func (h *HistogramVec) Observe(v float64, values ...string) {
+
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince records the time elapsed since start, in seconds, with the label values.
+func (h *HistogramVec) ObserveSince(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+
+	h.header(w, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulated uint64
+		for i, upper := range h.buckets {
+			cumulated += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(key, "le", formatFloat(upper)), cumulated)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelPairs(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelPairs(key), s.count)
+	}
+}
+
+// GaugeFunc is a gauge, partitioned by its labels, whose values are read on every scrape.
+type GaugeFunc struct {
+	family
+	read func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge with one label in the registry. read returns the values of the gauge, by the value of the label.
+func (reg *Registry) NewGaugeFunc(name string, help string, label string, read func() map[string]float64) *GaugeFunc {
+
+	g := &GaugeFunc{family: family{metricName: name, help: help, labels: []string{label}}, read: read}
+	reg.register(g)
+
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+
+	g.header(w, "gauge")
+
+	values := g.read()
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labelPairs(key), formatFloat(values[key]))
+	}
+}
+
+// formatFloat formats the value as in the text format.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape escapes the help text, or a label value (where the double quotes are escaped too).
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the outcomes of '/auth'.
+const (
+	AuthSuccess              = "success"
+	AuthInvalidCredentials   = "invalid_credentials"
+	AuthMethodNotAllowed     = "method_not_allowed"
+	AuthUnsupportedMediaType = "unsupported_media_type"
+	AuthError                = "error"
+)
+
+// the results of the verifications of the credentials (JWTs and API keys) by the Authenticate middleware.
+const (
+	VerifyValid         = "valid"
+	VerifyMissing       = "missing"
+	VerifyMalformed     = "malformed"
+	VerifyInvalid       = "invalid"
+	VerifyWrongAudience = "wrong_audience"
+	VerifyCSRFRejected  = "csrf_rejected"
+	VerifyRevoked       = "revoked"
+)
+
+// the decisions of the forward-auth endpoint, '/authz/forward'.
+const (
+	ForwardAllowed         = "allowed"
+	ForwardUnauthenticated = "unauthenticated"
+	ForwardForbidden       = "forbidden"
+)
+
+// the metrics of the service.
+var (
+	AuthAttempts = Default.NewCounterVec("passer_auth_attempts_total",
+		"Authentication attempts on /auth, by outcome.", "outcome")
+
+	TokenVerifications = Default.NewCounterVec("passer_token_verifications_total",
+		"Verifications of the credentials of the requests, by kind of credential (jwt, api_key) and result.", "credential", "result")
+
+	UserOperations = Default.NewCounterVec("passer_user_operations_total",
+		"Operations on the users through /users, by operation (create, read, update, delete) and result (success, failure).", "operation", "result")
+
+	ForwardAuthDecisions = Default.NewCounterVec("passer_forward_auth_decisions_total",
+		"Decisions of /authz/forward on the requests forwarded by the reverse proxies, by decision (allowed, unauthenticated, forbidden).", "decision")
+
+	BcryptDuration = Default.NewHistogramVec("passer_bcrypt_duration_seconds",
+		"Duration of the bcrypt operations, by operation (hash, compare).", DefaultBuckets, "operation")
+
+	RequestDuration = Default.NewHistogramVec("passer_http_request_duration_seconds",
+		"Duration of the http requests, by route, method and status code.", DefaultBuckets, "route", "method", "code")
+)
+
+// StatusRecorder is a http.ResponseWriter recording the status code of the response.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+// WriteHeader records the status code and writes it.
+func (rec *StatusRecorder) WriteHeader(status int) {
+	if rec.Status == 0 {
+		rec.Status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the body, with the status code 200 when none has been written.
+func (rec *StatusRecorder) Write(b []byte) (int, error) {
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// StatusCode returns the status code of the response, i.e. 200 when none has been written.
+func (rec *StatusRecorder) StatusCode() int {
+	if rec.Status == 0 {
+		return http.StatusOK
+	}
+	return rec.Status
+}
+
+// Instrument records the duration of the requests served by the mux, by the pattern of their route,
+// so the number of series does not grow with the paths requested.
+func Instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		rec := &StatusRecorder{ResponseWriter: w}
+
+		mux.ServeHTTP(rec, r)
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		RequestDuration.ObserveSince(start, route, method(r.Method), strconv.Itoa(rec.StatusCode()))
+	})
+}
+
+// method returns the request method, or 'other' for a non standard one, so the number of series is bounded.
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return m
+	}
+	return "other"
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+)
+
+// APIKeyClientId is the 'client_id' of the payload of a request authenticated by an API key.
+// Like the OAuth 2.0 tokens, the request is then restricted to the scopes of the key (see RequireScope).
+const APIKeyClientId = "api-key"
+
+// apiKeyFrom returns the API key carried by the request, if any.
+func apiKeyFrom(r *http.Request) string {
+
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+
+	authorization := strings.TrimSpace(r.Header.Get("Authorization"))
+	for _, scheme := range []string{"ApiKey ", "Bearer "} {
+		if strings.HasPrefix(authorization, scheme) {
+			credential := strings.TrimSpace(strings.TrimPrefix(authorization, scheme))
+			if strings.HasPrefix(credential, models.APIKeyPrefix) {
+				return credential
+			}
+		}
+	}
+
+	return ""
+}
+
+// verifyAPIKey checks the key and returns the payload of the user the key belongs to, restricted to the scopes of the key.
+func verifyAPIKey(ctx context.Context, keys *data.APIKeyStore, ds *data.DataStore, roles *data.RoleStore, orgs *data.OrganizationStore, key string, ip string) (jwt.JWTPayload, bool) {
+
+	if keys == nil || ds == nil || roles == nil {
+		return jwt.JWTPayload{}, false
+	}
+
+	// psr_<id>_<secret>; the id is hex encoded, i.e. has no '_'.
+	id, _, ok := strings.Cut(strings.TrimPrefix(key, models.APIKeyPrefix), "_")
+	if !ok {
+		return jwt.JWTPayload{}, false
+	}
+
+	k, err := keys.Find(id)
+	if err != nil {
+		return jwt.JWTPayload{}, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(helpers.HashToken(key)), []byte(k.Hash)) != 1 {
+		return jwt.JWTPayload{}, false
+	}
+
+	now := time.Now()
+	if k.HasExpired(now) || !k.AllowsIP(ip) {
+		return jwt.JWTPayload{}, false
+	}
+
+	found, err := ds.FindContext(ctx, k.UserId)
+	if err != nil {
+		return jwt.JWTPayload{}, false
+	}
+	user := found.GetItem().(models.User)
+	if !user.IsActive {
+		return jwt.JWTPayload{}, false
+	}
+
+	exp := now.Add(time.Minute).UnixMilli()
+	if !k.ExpiresAt.IsZero() {
+		exp = k.ExpiresAt.UnixMilli()
+	}
+
+	org, perms := data.ClaimsOf(user, roles, orgs)
+
+	return jwt.JWTPayload{
+		Id:       user.Email,
+		Name:     strings.TrimSpace(user.Name.First + " " + user.Name.Last),
+		Roles:    user.Roles,
+		IsActive: user.IsActive,
+		Exp:      exp,
+		Perms:    perms,
+		Org:      org,
+		Sub:      user.Id,
+		ClientId: APIKeyClientId,
+		Scope:    strings.Join(k.Scopes, " "),
+	}, true
+}
+
+// ClientIP returns the ip address of the connection the request came from.
+func ClientIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+)
+
+// Audit records the action of the request, r, on the target, in the audit log, by the subject of the credential of the request (see PayloadFrom).
+// The party acting on behalf of the subject, if any (e.g. the admin impersonating a user), is recorded as the actor too.
+func Audit(r *http.Request, action string, target string, outcome string) {
+
+	actor := ""
+	if pl, ok := PayloadFrom(r.Context()); ok {
+		actor = pl.Subject()
+		if pl.Act != nil {
+			actor = fmt.Sprintf("%s on behalf of %s", pl.Act.Sub, actor)
+		}
+	}
+
+	AuditAs(r, actor, action, target, outcome)
+}
+
+// AuditAs records the action of the request, r, on the target, in the audit log, by the actor,
+// e.g. the email of a login attempt, as the request is not authenticated yet.
+func AuditAs(r *http.Request, actor string, action string, target string, outcome string) {
+	audit.Record(audit.Event{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		Outcome:   outcome,
+		IP:        ClientIP(r),
+		RequestID: RequestIDFrom(r.Context()),
+	})
+}
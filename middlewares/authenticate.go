@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/config"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/metrics"
+)
+
+// Revoker is implemented by the stores of the tokens that can be revoked before they expire (e.g. impersonation sessions).
+type Revoker interface {
+	IsRevoked(pl jwt.JWTPayload) bool
+}
+
+// Authenticate is the successor of ValidateJWT. It permits the request to continue when it carries either
+// - a valid API key, in the 'X-API-Key' header or as the 'Authorization' header ('ApiKey' or 'Bearer' scheme); or
+// - a valid JWT, in the 'Authorization' header, as checked by ValidateJWT, that none of the revokers has revoked.
+// In both cases, the payload of the credential is available to the next handlers through PayloadFrom.
+// The permissions (and organization) of an API key are those of its user, resolved with the role and organization stores on every request.
+func Authenticate(cfg *config.Config, keys *data.APIKeyStore, ds *data.DataStore, roles *data.RoleStore, orgs *data.OrganizationStore, revokers ...Revoker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+
+		validateJWT := ValidateJWT(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			pl, _ := PayloadFrom(r.Context())
+			for _, revoker := range revokers {
+				if revoker.IsRevoked(pl) {
+					metrics.TokenVerifications.Inc("jwt", metrics.VerifyRevoked)
+					helpers.WriteJSON(w, http.StatusForbidden, false, "[JWT]: token has been revoked", nil)
+					return
+				}
+			}
+
+			metrics.TokenVerifications.Inc("jwt", metrics.VerifyValid)
+			next.ServeHTTP(w, r)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			key := apiKeyFrom(r)
+			if key == "" {
+				// not an API key. must be a JWT.
+				validateJWT.ServeHTTP(w, r)
+				return
+			}
+
+			pl, ok := verifyAPIKey(r.Context(), keys, ds, roles, orgs, key, ClientIP(r))
+			if !ok {
+				metrics.TokenVerifications.Inc("api_key", metrics.VerifyInvalid)
+				helpers.WriteJSON(w, http.StatusForbidden, false, "[Middleware]: api key is invalid, expired or not allowed from this ip", nil)
+				return
+			}
+
+			metrics.TokenVerifications.Inc("api_key", metrics.VerifyValid)
+			logging.With(r.Context(), logging.FieldUserID, pl.Subject())
+			ctx := context.WithValue(r.Context(), payloadKey, pl)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
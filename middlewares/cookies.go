@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionCookieName is the name of the cookie carrying the JWT of a cookie session (see '/auth?mode=cookie').
+	SessionCookieName = "passer_session"
+
+	// CSRFCookieName is the name of the cookie carrying the CSRF token of a cookie session.
+	// It is readable by the scripts of the web portal, which must echo it in the CSRFHeaderName header.
+	CSRFCookieName = "passer_csrf"
+
+	// CSRFHeaderName is the request header carrying the CSRF token, on the state-changing requests of a cookie session.
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CookieOptions are the attributes of the cookies of a cookie session.
+type CookieOptions struct {
+	Domain   string
+	SameSite http.SameSite
+}
+
+// SetSessionCookies sets the cookies of a cookie session, for the token with the 'jti', which expires at exp.
+// The session cookie is 'HttpOnly', so the scripts of the web portal never see the token; the CSRF cookie is not.
+// Both are 'Secure', as the service is only served over https.
+func SetSessionCookies(w http.ResponseWriter, opts CookieOptions, token string, csrfToken string, exp time.Time) {
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   opts.Domain,
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: opts.SameSite,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		Domain:   opts.Domain,
+		Expires:  exp,
+		Secure:   true,
+		SameSite: opts.SameSite,
+	})
+}
+
+// ClearSessionCookies expires the cookies of a cookie session, e.g. on logout.
+func ClearSessionCookies(w http.ResponseWriter, opts CookieOptions) {
+
+	for _, name := range []string{SessionCookieName, CSRFCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			Domain:   opts.Domain,
+			MaxAge:   -1,
+			HttpOnly: name == SessionCookieName,
+			Secure:   true,
+			SameSite: opts.SameSite,
+		})
+	}
+}
+
+// CSRFToken returns the CSRF token of the session with the 'jti'.
+// It is derived from the secret key, so it needs no storage, and cannot be forged by another site;
+// it is bound to the session, so a token planted by a sibling (sub)domain is of no use either.
+func CSRFToken(secretKey string, jti string) string {
+
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte("csrf:" + jti))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tokenFrom returns the JWT carried by the request, in the 'Authorization' header, or else in the session cookie.
+// fromCookie reports that the token came from the cookie, i.e. the browser attached it on its own.
+func tokenFrom(r *http.Request) (token string, fromCookie bool) {
+
+	if authorization := strings.TrimSpace(r.Header.Get("Authorization")); authorization != "" {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")), false
+	}
+
+	c, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(c.Value), true
+}
+
+// isSafeMethod checks if the request method does not change any state, and so needs no CSRF token.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// validCSRF checks that the request carries the CSRF token of the session with the 'jti', in the CSRFHeaderName header.
+func validCSRF(r *http.Request, secretKey string, jti string) bool {
+
+	got := strings.TrimSpace(r.Header.Get(CSRFHeaderName))
+	if got == "" || jti == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(CSRFToken(secretKey, jti))) == 1
+}
@@ -1,72 +1,45 @@
 package middlewares
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/go-qiu/passer-auth-service/config"
+	"github.com/go-qiu/passer-auth-service/helpers"
 	"github.com/go-qiu/passer-auth-service/jwt"
-	"github.com/joho/godotenv"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/tracing"
 )
 
-// ValidateJWT is a middleware that will check for the presence of a 'Token' attribute in the request header.
+// ValidateJWT is a middleware that will check for the presence of a 'Token' attribute in the request header (or in the session cookie).
 // It will permit the request to continue its flow to the secureed api endpoint if the 'Token' is present and valid.
 // A valid 'Token' must satisfy the following:
-// - the signature segment of the 'Token' must be consistent when this middleware signs the content of the Header and Payload segments (of the 'Token') with the secret key;
-// - the 'exp' attribute in the Payload (encoded in Base64 format) has not come to pass.
-func ValidateJWT(next http.Handler) http.Handler {
+// - the signature segment of the 'Token' must be consistent when this middleware signs the content of the Header and Payload segments (of the 'Token') with the secret key of the configuration, cfg;
+// - the 'exp' attribute in the Payload (encoded in Base64 format) has not come to pass;
+// - when it comes from the session cookie, a state-changing request also carries the CSRF token of the session.
+func ValidateJWT(cfg *config.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		// declare custom loggers
-		// infoLog := log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
-		errorLog := log.New(os.Stderr, "[ERROR]\t", log.Ldate|log.Ltime|log.Lshortfile)
+		logger := logging.FromContext(r.Context())
 
-		// get .env values
-		err := godotenv.Load()
-		if err != nil {
-			errString := "[JWT]: fail to load .env"
-			errorLog.Println(errString)
-			// http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Header().Set("Content-Type", "application/json")
-			msg := fmt.Sprintf(`{
-				"ok": false,
-				"msg": "%s",
-				"data": {}
-			}`, errString)
-			fmt.Fprintln(w, msg)
-			return
-		}
-		JWT_SECRET_KEY := os.Getenv("JWT_SECRET_KEY")
-
-		// get the jwt from the request header.
-		authorization := r.Header.Get("Authorization")
-		if strings.TrimSpace(authorization) == "" {
-
-			errString := "[Middleware]: no token found"
-			errorLog.Println(errString)
-
-			// http.Error(w, msg, http.StatusForbidden)
-
-			w.WriteHeader(http.StatusForbidden)
-			w.Header().Set("Content-Type", "application/json")
-			msg := fmt.Sprintf(`{
-				"ok": false,
-				"msg": "%s",
-				"data": {}
-			}`, errString)
-			fmt.Fprintln(w, msg)
-			return
+		// the span times the validation only, so it is ended before the request goes on to the next handler.
+		_, span := tracing.Start(r.Context(), "ValidateJWT")
+		defer span.End()
+		verified := func(result string) {
+			metrics.TokenVerifications.Inc("jwt", result)
+			span.SetAttribute("jwt.result", result)
 		}
 
-		token := strings.TrimPrefix(authorization, "Bearer ")
+		// get the jwt from the request header, or else from the session cookie.
+		token, fromCookie := tokenFrom(r)
 		if strings.TrimSpace(token) == "" {
 			// empty token
+			verified(metrics.VerifyMissing)
 			errString := "[Middleware]: no token found"
-			errorLog.Println(errString)
+			logger.Warn(errString)
 			// http.Error(w, errString, http.StatusForbidden)
 
 			w.WriteHeader(http.StatusForbidden)
@@ -82,10 +55,11 @@ func ValidateJWT(next http.Handler) http.Handler {
 
 		// ok.
 		// jwt validation logic here.
-		ok, err := jwt.Verify(token, JWT_SECRET_KEY)
+		ok, err := jwt.Verify(token, cfg.JWTSecretKey)
 		if err != nil {
+			verified(metrics.VerifyMalformed)
 
-			errorLog.Println(err.Error())
+			logger.Warn("[Middleware]: fail to verify token", logging.FieldError, err)
 			// http.Error(w, err.Error(), http.StatusForbidden)
 
 			w.WriteHeader(http.StatusForbidden)
@@ -100,6 +74,7 @@ func ValidateJWT(next http.Handler) http.Handler {
 		}
 
 		if !ok {
+			verified(metrics.VerifyInvalid)
 
 			errString := "[JWT]: fail to validate token"
 			// http.Error(w, errString, http.StatusForbidden)
@@ -115,7 +90,52 @@ func ValidateJWT(next http.Handler) http.Handler {
 			return
 		}
 
+		// ok. make the payload available to the next handlers.
+		pl, err := jwt.Decode(token)
+		if err != nil {
+			verified(metrics.VerifyMalformed)
+			logger.Warn("[Middleware]: fail to verify token", logging.FieldError, err)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			msg := fmt.Sprintf(`{
+				"ok": false,
+				"msg": "%s",
+				"data": {}
+			}`, err)
+			fmt.Fprintln(w, msg)
+			return
+		}
+		// an audience-restricted token (see the token exchange grant) is only accepted by its audience.
+		if pl.Aud != "" && pl.Aud != cfg.JWTIssuer {
+			verified(metrics.VerifyWrongAudience)
+			helpers.WriteJSON(w, http.StatusForbidden, false, "[JWT]: token is restricted to another audience", nil)
+			return
+		}
+		// the browser attaches the session cookie on its own, so a state-changing request must prove it comes from the web portal.
+		if fromCookie && !isSafeMethod(r.Method) && !validCSRF(r, cfg.JWTSecretKey, pl.Jti) {
+			verified(metrics.VerifyCSRFRejected)
+			helpers.WriteJSON(w, http.StatusForbidden, false, "[Middleware]: csrf token is missing or invalid", nil)
+			return
+		}
+		logging.With(r.Context(), logging.FieldUserID, pl.Subject())
+		span.SetAttribute("jwt.subject", pl.Subject())
+		span.End()
+		ctx := context.WithValue(r.Context(), payloadKey, pl)
+
 		// direct the request to the next handler.
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// contextKey is the type of the keys of the values kept in the request context by the middlewares.
+type contextKey string
+
+// payloadKey is the request context key of the payload of the token validated by ValidateJWT.
+const payloadKey contextKey = "jwtPayload"
+
+// PayloadFrom returns the payload of the token validated by ValidateJWT.
+func PayloadFrom(ctx context.Context) (jwt.JWTPayload, bool) {
+	pl, ok := ctx.Value(payloadKey).(jwt.JWTPayload)
+	return pl, ok
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+)
+
+// Granted checks if the token, pl, grants the permission: a permission of its subject, resolved from the roles of the user
+// when the token is issued (see jwt.JWTPayload.HasPermission), within the scopes of the token when it was issued to a client
+// (an OAuth 2.0 client, an API key, a delegation), as the token carries all the permissions of the user, e.g. an API key
+// scoped to 'parcels:collect' does not grant the other permissions of its user.
+func Granted(pl jwt.JWTPayload, perm string) bool {
+	return pl.HasPermission(perm) && (pl.ClientId == "" || pl.HasScope(perm))
+}
+
+// RequirePermission is a middleware, used after Authenticate, that will only permit the request to continue
+// when the token grants the required permission (see Granted): readPerm for the 'GET' and 'HEAD' requests and writePerm for the other request methods.
+func RequirePermission(readPerm string, writePerm string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		pl, ok := PayloadFrom(r.Context())
+		if !ok {
+			helpers.WriteJSON(w, http.StatusForbidden, false, "[Middleware]: no token found", nil)
+			return
+		}
+
+		perm := writePerm
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			perm = readPerm
+		}
+
+		if !Granted(pl, perm) {
+			errString := fmt.Sprintf("[Middleware]: token was not granted the '%s' permission", perm)
+			helpers.WriteJSON(w, http.StatusForbidden, false, errString, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
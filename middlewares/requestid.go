@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/metrics"
+)
+
+// RequestIDHeader is the header of the id of a request, to correlate its log lines across the services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request id accepted from the caller.
+const maxRequestIDLength = 128
+
+// RequestID is a middleware that identifies the request with the id of its 'X-Request-ID' header, or else with a new random id,
+// and sets it on the response. The request carries a logger (see logging.FromContext) with its id, route, method and client ip.
+// Once handled, the request is logged, with its status and duration (the access log).
+// The route is the pattern of the mux matching the request, so the paths with an id are logged alike.
+func RequestID(logger *slog.Logger, mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id, _ = helpers.NewRandomToken(16)
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = logging.NewContext(ctx, logger.With(
+			logging.FieldRequestID, id,
+			logging.FieldRoute, route,
+			logging.FieldMethod, r.Method,
+			logging.FieldClientIP, ClientIP(r),
+		))
+		r = r.WithContext(ctx)
+
+		rec := &metrics.StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		logging.FromContext(ctx).Info("[Server]: request served", "status", rec.StatusCode(), "duration_ms", time.Since(start).Milliseconds())
+	})
+}
+
+// requestIDKey is the request context key of the id of the request.
+const requestIDKey contextKey = "requestID"
+
+// RequestIDFrom returns the id of the request set by RequestID, if any.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// validRequestID checks if the request id of the caller can be logged as is, i.e. is short and made of printable ascii characters.
+func validRequestID(id string) bool {
+
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/helpers"
+)
+
+// RequireScope is a middleware, used after ValidateJWT, that will only permit the request to continue
+// when the token was granted the required scope: readScope for the 'GET' and 'HEAD' requests and writeScope for the other request methods.
+// The tokens issued by '/auth' (i.e. without a 'client_id') are first-party tokens and are not restricted by scopes.
+func RequireScope(readScope string, writeScope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		pl, ok := PayloadFrom(r.Context())
+		if !ok {
+			helpers.WriteJSON(w, http.StatusForbidden, false, "[Middleware]: no token found", nil)
+			return
+		}
+
+		if pl.ClientId == "" {
+			// first-party token.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope := writeScope
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = readScope
+		}
+
+		if !pl.HasScope(scope) {
+			errString := fmt.Sprintf("[Middleware]: token was not granted the '%s' scope", scope)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			helpers.WriteJSON(w, http.StatusForbidden, false, errString, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
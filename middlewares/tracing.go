@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/tracing"
+)
+
+// Trace is a middleware that records the request as the server span of its trace, named after its route (the pattern of the mux matching it).
+// The trace continues the trace of the caller, from its 'traceparent' header, if any. The trace id is logged with the request.
+func Trace(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := r.Context()
+		if sc, ok := tracing.ParseTraceParent(r.Header.Get(tracing.TraceParentHeader)); ok {
+			ctx = tracing.ContextWithRemote(ctx, sc)
+		}
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracing.StartServer(ctx, fmt.Sprintf("%s %s", r.Method, route))
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		logging.With(ctx, logging.FieldTraceID, span.SpanContext().TraceID.String())
+
+		rec := &metrics.StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", rec.StatusCode())
+		if rec.StatusCode() >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%s", http.StatusText(rec.StatusCode())))
+		}
+	})
+}
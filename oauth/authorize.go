@@ -0,0 +1,251 @@
+package oauth
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/users"
+)
+
+// authorizeRequest holds the parameters of an authorization request (RFC 6749, section 4.1.1 and RFC 7636, section 4.3).
+type authorizeRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// loginPage is the data rendered in the login and consent page.
+type loginPage struct {
+	Params     authorizeRequest
+	ClientName string
+	Scopes     []string
+	Error      string
+	CSRFToken  string
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>PASSER - Sign in</title>
+</head>
+<body>
+	<h1>Sign in to PASSER</h1>
+	<p><strong>{{.ClientName}}</strong> is requesting access to your account.</p>
+	{{if .Scopes}}
+	<p>It will be allowed to:</p>
+	<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+	{{end}}
+	{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+	<form method="POST" action="/oauth/authorize">
+		<input type="hidden" name="response_type" value="{{.Params.ResponseType}}">
+		<input type="hidden" name="client_id" value="{{.Params.ClientId}}">
+		<input type="hidden" name="redirect_uri" value="{{.Params.RedirectURI}}">
+		<input type="hidden" name="scope" value="{{.Params.Scope}}">
+		<input type="hidden" name="state" value="{{.Params.State}}">
+		<input type="hidden" name="code_challenge" value="{{.Params.CodeChallenge}}">
+		<input type="hidden" name="code_challenge_method" value="{{.Params.CodeChallengeMethod}}">
+		<input type="hidden" name="nonce" value="{{.Params.Nonce}}">
+		<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+		<p><label>Email <input type="email" name="email" autocomplete="username" required></label></p>
+		<p><label>Password <input type="password" name="pw" autocomplete="current-password" required></label></p>
+		<button type="submit" name="consent" value="allow">Allow</button>
+		<button type="submit" name="consent" value="deny" formnovalidate>Deny</button>
+	</form>
+</body>
+</html>
+`))
+
+// Authorize handles the authorization endpoint, '/oauth/authorize', of the authorization code grant with PKCE.
+// A 'GET' request renders the login and consent page; the 'POST' request of the page checks the credentials
+// and redirects the user agent back to the client with the authorization code.
+func (s *Server) Authorize(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	params := authorizeRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientId:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		Nonce:               r.Form.Get("nonce"),
+	}
+
+	// the user agent is never redirected to a uri that is not registered for the client (RFC 6749, section 4.1.2.1).
+	client, err := s.Clients.Find(params.ClientId)
+	if err != nil {
+		http.Error(w, "[OAuth]: unknown client", http.StatusBadRequest)
+		return
+	}
+	if !client.HasRedirectURI(params.RedirectURI) {
+		http.Error(w, "[OAuth]: redirect_uri is not registered for the client", http.StatusBadRequest)
+		return
+	}
+
+	// ok. errors are reported to the client from here on.
+	if params.ResponseType != "code" {
+		redirectError(w, r, params, errUnsupportedRespType, "only the 'code' response type is supported")
+		return
+	}
+	if !client.AllowsGrant(grantAuthorizationCode) {
+		redirectError(w, r, params, errUnauthorizedClient, "the client is not allowed to use the authorization code grant")
+		return
+	}
+	if params.CodeChallenge == "" || params.CodeChallengeMethod != "S256" {
+		redirectError(w, r, params, errInvalidRequest, "a S256 code_challenge is required")
+		return
+	}
+
+	scopes := parseScopes(params.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		redirectError(w, r, params, errInvalidScope, "requested scope is not allowed for the client")
+		return
+	}
+
+	page := loginPage{Params: params, ClientName: client.Name, Scopes: scopes}
+	posted := r.Method == http.MethodPost
+	validCSRF := posted && s.validFormCSRF(r)
+
+	page.CSRFToken, err = s.formCSRFToken(w, r, "/oauth/authorize")
+	if err != nil {
+		redirectError(w, r, params, errServerError, "")
+		return
+	}
+
+	if !posted {
+		renderLogin(w, http.StatusOK, page)
+		return
+	}
+
+	// 'POST' request from the login and consent page, which must be the page rendered to this user agent,
+	// so another site cannot sign the user in (or deny the request) on its behalf.
+	if !validCSRF {
+		page.Error = "The page has expired. Please sign in again."
+		renderLogin(w, http.StatusForbidden, page)
+		return
+	}
+	if r.PostForm.Get("consent") != "allow" {
+		redirectError(w, r, params, errAccessDenied, "the user denied the request")
+		return
+	}
+
+	user, err := users.CheckCredentials(r.Context(), s.DataStore, r.PostForm.Get("email"), r.PostForm.Get("pw"))
+	if err != nil {
+		middlewares.AuditAs(r, r.PostForm.Get("email"), audit.ActionLogin, r.PostForm.Get("email"), audit.OutcomeFailure)
+		page.Error = "The email or password is not correct."
+		renderLogin(w, http.StatusUnauthorized, page)
+		return
+	}
+	middlewares.AuditAs(r, user.Id, audit.ActionLogin, user.Id, audit.OutcomeSuccess)
+
+	code, err := s.issueCode(client, user, params, scopes)
+	if err != nil {
+		redirectError(w, r, params, errServerError, "")
+		return
+	}
+
+	q := url.Values{}
+	q.Set("code", code)
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+	redirect(w, r, params.RedirectURI, q)
+}
+
+// issueCode generates an authorization code for the user and keeps its hash, with the request parameters, in the code store.
+func (s *Server) issueCode(client models.Client, user models.User, params authorizeRequest, scopes []string) (string, error) {
+
+	raw, err := helpers.NewRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = s.Codes.Insert(models.AuthCode{
+		Hash:          helpers.HashToken(raw),
+		ClientId:      client.Id,
+		RedirectURI:   params.RedirectURI,
+		UserId:        user.Id,
+		Scopes:        scopes,
+		CodeChallenge: params.CodeChallenge,
+		Nonce:         params.Nonce,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(s.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// renderLogin renders the login and consent page.
+func renderLogin(w http.ResponseWriter, status int, page loginPage) {
+
+	// the page must not be framed by another site (i.e. clickjacking) or cached.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	loginTemplate.Execute(w, page)
+}
+
+// redirectError redirects the user agent back to the client with an error (RFC 6749, section 4.1.2.1).
+func redirectError(w http.ResponseWriter, r *http.Request, params authorizeRequest, code string, description string) {
+
+	q := url.Values{}
+	q.Set("error", code)
+	if description != "" {
+		q.Set("error_description", description)
+	}
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+	redirect(w, r, params.RedirectURI, q)
+}
+
+// redirect redirects the user agent to the uri, with q appended to its query.
+func redirect(w http.ResponseWriter, r *http.Request, uri string, q url.Values) {
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	existing := u.Query()
+	for k, v := range q {
+		existing[k] = v
+	}
+	u.RawQuery = existing.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
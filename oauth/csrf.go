@@ -0,0 +1,54 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// formCSRFCookieName is the name of the cookie binding the login forms of the pages of the authorization server to the user agent.
+const formCSRFCookieName = "passer_oauth_csrf"
+
+// formCSRFField is the name of the hidden field of the forms carrying the CSRF token.
+const formCSRFField = "csrf_token"
+
+// formCSRFToken returns the CSRF token of the form of the page at path, for the user agent of the request.
+// The user agent is given a random id in an 'HttpOnly' cookie, kept across the pages, and the token is derived from it (see middlewares.CSRFToken),
+// so a form posted by another site, without the cookie, is rejected (see validFormCSRF).
+func (s *Server) formCSRFToken(w http.ResponseWriter, r *http.Request, path string) (string, error) {
+
+	id := ""
+	if c, err := r.Cookie(formCSRFCookieName); err == nil && c.Value != "" {
+		id = c.Value
+	} else {
+		id, err = helpers.NewRandomToken(32)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     formCSRFCookieName,
+		Value:    id,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return middlewares.CSRFToken(s.SecretKey, "oauth-form:"+id), nil
+}
+
+// validFormCSRF checks the CSRF token of the form posted with the request against the cookie of the user agent.
+func (s *Server) validFormCSRF(r *http.Request) bool {
+
+	c, err := r.Cookie(formCSRFCookieName)
+	got := r.PostForm.Get(formCSRFField)
+	if err != nil || c.Value == "" || got == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(middlewares.CSRFToken(s.SecretKey, "oauth-form:"+c.Value))) == 1
+}
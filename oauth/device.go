@@ -0,0 +1,354 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/users"
+)
+
+// userCodeAlphabet excludes the vowels (i.e. no words are spelled) and the look-alike characters (RFC 8628, section 6.1).
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// userCodeLength is the number of characters of a user code, shown as XXXX-XXXX.
+const userCodeLength = 8
+
+// deviceAuthorizationResponse is the response of the device authorization endpoint (RFC 8628, section 3.2).
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// devicePage is the data rendered in the device verification page.
+type devicePage struct {
+	UserCode   string
+	ClientName string
+	Scopes     []string
+	Error      string
+	Done       string
+	CSRFToken  string
+}
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>PASSER - Sign in a device</title>
+</head>
+<body>
+	<h1>Sign in a device to PASSER</h1>
+	{{if .Done}}
+	<p role="status">{{.Done}}</p>
+	{{else}}
+	{{if .ClientName}}<p><strong>{{.ClientName}}</strong> is requesting access to your account.</p>{{end}}
+	{{if .Scopes}}
+	<p>It will be allowed to:</p>
+	<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+	{{end}}
+	{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+	<form method="POST" action="/oauth/device">
+		<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+		<p><label>Code shown on the device <input type="text" name="user_code" value="{{.UserCode}}" autocomplete="off" required></label></p>
+		<p><label>Email <input type="email" name="email" autocomplete="username" required></label></p>
+		<p><label>Password <input type="password" name="pw" autocomplete="current-password" required></label></p>
+		<button type="submit" name="consent" value="allow">Allow</button>
+		<button type="submit" name="consent" value="deny">Deny</button>
+	</form>
+	{{end}}
+</body>
+</html>
+`))
+
+// DeviceAuthorization handles the device authorization endpoint, '/oauth/device_authorization' (RFC 8628, section 3.1).
+// A device without a suitable keyboard (e.g. a locker station kiosk) obtains a device code to poll with and
+// a user code for the user to approve on another device (e.g. the user's phone).
+func (s *Server) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errInvalidRequest, "the device authorization endpoint only accepts 'POST' requests")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "the request body is not a valid form")
+		return
+	}
+
+	client, ok := s.authenticateClient(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	if !client.AllowsGrant(grantDeviceCode) {
+		writeError(w, http.StatusBadRequest, errUnauthorizedClient, "the client is not allowed to use the device authorization grant")
+		return
+	}
+
+	scopes := parseScopes(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		writeError(w, http.StatusBadRequest, errInvalidScope, "requested scope is not allowed for the client")
+		return
+	}
+
+	deviceCode, err := helpers.NewRandomToken(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	// a user code collision is unlikely, but is retried.
+	var userCode string
+	for i := 0; i < 5; i++ {
+		userCode, err = newUserCode()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errServerError, "")
+			return
+		}
+
+		err = s.Devices.Insert(models.DeviceCode{
+			Hash:      helpers.HashToken(deviceCode),
+			UserCode:  userCode,
+			ClientId:  client.Id,
+			Scopes:    scopes,
+			Status:    models.DeviceStatusPending,
+			Interval:  s.DevicePollInterval,
+			ExpiresAt: time.Now().Add(s.DeviceCodeTTL),
+		})
+		if err != data.ErrDuplicatedDeviceCode {
+			break
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	verificationURI := s.IssuerURL + "/oauth/device"
+	q := url.Values{}
+	q.Set("user_code", formatUserCode(userCode))
+
+	writeToken(w, deviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + q.Encode(),
+		ExpiresIn:               int64(s.DeviceCodeTTL.Seconds()),
+		Interval:                int64(s.DevicePollInterval.Seconds()),
+	})
+}
+
+// Device handles the device verification page, '/oauth/device' (RFC 8628, section 3.3).
+// The user enters the user code shown on the device, signs in and approves (or denies) the device.
+func (s *Server) Device(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	page := devicePage{UserCode: r.Form.Get("user_code")}
+	userCode := normalizeUserCode(page.UserCode)
+
+	// show the client and scopes of a (prefilled) user code.
+	var d models.DeviceCode
+	if userCode != "" {
+		d, err = s.Devices.FindByUserCode(userCode)
+		if err == nil {
+			client, err := s.Clients.Find(d.ClientId)
+			if err == nil {
+				page.ClientName = client.Name
+				page.Scopes = d.Scopes
+			}
+		}
+	}
+
+	posted := r.Method == http.MethodPost
+	validCSRF := posted && s.validFormCSRF(r)
+
+	page.CSRFToken, err = s.formCSRFToken(w, r, "/oauth/device")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !posted {
+		renderDevice(w, http.StatusOK, page)
+		return
+	}
+
+	// 'POST' request from the verification page, which must be the page rendered to this user agent.
+	if !validCSRF {
+		page.Error = "The page has expired. Please sign in again."
+		renderDevice(w, http.StatusForbidden, page)
+		return
+	}
+	if d.UserCode == "" {
+		page.Error = "The code is not valid or has expired."
+		renderDevice(w, http.StatusBadRequest, page)
+		return
+	}
+
+	// the user is signed in to approve or deny the device, so a user code shown on a device cannot be denied by anyone else.
+	user, err := users.CheckCredentials(r.Context(), s.DataStore, r.PostForm.Get("email"), r.PostForm.Get("pw"))
+	if err != nil {
+		middlewares.AuditAs(r, r.PostForm.Get("email"), audit.ActionLogin, r.PostForm.Get("email"), audit.OutcomeFailure)
+		page.Error = "The email or password is not correct."
+		renderDevice(w, http.StatusUnauthorized, page)
+		return
+	}
+	middlewares.AuditAs(r, user.Id, audit.ActionLogin, user.Id, audit.OutcomeSuccess)
+
+	if r.PostForm.Get("consent") != "allow" {
+		err = s.Devices.Deny(userCode)
+		if err != nil {
+			page.Error = "The code is not valid or has expired."
+			renderDevice(w, http.StatusBadRequest, page)
+			return
+		}
+		page.Done = "The device was denied access. You can close this page."
+		renderDevice(w, http.StatusOK, page)
+		return
+	}
+
+	err = s.Devices.Approve(userCode, user.Id, time.Now())
+	if err != nil {
+		page.Error = "The code is not valid or has expired."
+		renderDevice(w, http.StatusBadRequest, page)
+		return
+	}
+
+	page.Done = "The device is signed in. You can close this page and return to the device."
+	renderDevice(w, http.StatusOK, page)
+}
+
+// deviceCodeGrant exchanges an approved device code for an access token (RFC 8628, section 3.4 and 3.5).
+func (s *Server) deviceCodeGrant(w http.ResponseWriter, r *http.Request) {
+
+	client, ok := s.authenticateClient(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	deviceCode := r.PostForm.Get("device_code")
+	if deviceCode == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "device_code is required")
+		return
+	}
+
+	// the device code of another client is neither consumed nor slowed down by the request.
+	d, err := s.Devices.Poll(helpers.HashToken(deviceCode), client.Id, time.Now())
+	switch err {
+	case nil:
+	case data.ErrAuthorizationPending:
+		writeError(w, http.StatusBadRequest, errAuthorizationPending, "")
+		return
+	case data.ErrSlowDown:
+		writeError(w, http.StatusBadRequest, errSlowDown, "")
+		return
+	case data.ErrDeviceCodeDenied:
+		writeError(w, http.StatusBadRequest, errAccessDenied, "the user denied the request")
+		return
+	case data.ErrDeviceCodeExpired:
+		writeError(w, http.StatusBadRequest, errExpiredToken, "")
+		return
+	default:
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "device_code is invalid")
+		return
+	}
+
+	found, err := s.DataStore.FindContext(r.Context(), d.UserId)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "the user is no longer registered")
+		return
+	}
+	user := found.GetItem().(models.User)
+	if !user.IsActive {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "the user is not active")
+		return
+	}
+
+	t, err := s.issueAccessToken(user, client.Id, d.Scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	if hasScope(d.Scopes, scopeOpenId) {
+		t.IdToken, err = s.issueIdToken(user, client.Id, d.Scopes, "", d.AuthTime)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errServerError, "")
+			return
+		}
+	}
+
+	writeToken(w, t)
+}
+
+// renderDevice renders the device verification page.
+func renderDevice(w http.ResponseWriter, status int, page devicePage) {
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	deviceTemplate.Execute(w, page)
+}
+
+// newUserCode generates a random user code from userCodeAlphabet.
+func newUserCode() (string, error) {
+
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// formatUserCode formats the user code as XXXX-XXXX, for readability.
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode removes the separators and whitespace the user may have typed, and upper cases the user code.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || c == ' ' {
+			return -1
+		}
+		return c
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
@@ -0,0 +1,135 @@
+package oauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+)
+
+const testDeviceClientId = "locker-kiosk-01"
+
+// deviceServer returns an authorization server with a pending device authorization of the kiosk, and its device code and user code.
+func deviceServer(t *testing.T) (*Server, string, string) {
+	t.Helper()
+
+	s := testServer(t)
+	s.Devices = data.NewDeviceCodeStore()
+	s.DeviceCodeTTL = time.Minute
+	s.DevicePollInterval = time.Second
+
+	deviceCode, userCode := "device-code", "BCDFGHJK"
+	err := s.Devices.Insert(models.DeviceCode{
+		Hash:      helpers.HashToken(deviceCode),
+		UserCode:  userCode,
+		ClientId:  testDeviceClientId,
+		Scopes:    []string{"profile"},
+		Status:    models.DeviceStatusPending,
+		Interval:  s.DevicePollInterval,
+		ExpiresAt: time.Now().Add(s.DeviceCodeTTL),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, deviceCode, userCode
+}
+
+// TestDeviceDecisionNeedsCredentials checks that a user code is only approved or denied by a signed in user.
+func TestDeviceDecisionNeedsCredentials(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		consent    string
+		pw         string
+		wantStatus int
+		// the pending user code can still be found after the request.
+		wantPending bool
+	}{
+		{name: "deny without credentials", consent: "deny", pw: "", wantStatus: http.StatusUnauthorized, wantPending: true},
+		{name: "deny with a wrong password", consent: "deny", pw: "wrong", wantStatus: http.StatusUnauthorized, wantPending: true},
+		{name: "deny", consent: "deny", pw: "Testing.12345", wantStatus: http.StatusOK, wantPending: false},
+		{name: "allow", consent: "allow", pw: "Testing.12345", wantStatus: http.StatusOK, wantPending: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s, _, userCode := deviceServer(t)
+
+			w := httptest.NewRecorder()
+			s.Device(w, httptest.NewRequest(http.MethodGet, "/oauth/device?user_code="+userCode, nil))
+			m := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+			if m == nil {
+				t.Fatal("the verification page has no CSRF token")
+			}
+
+			form := url.Values{
+				"user_code":   {userCode},
+				"email":       {"joe.jet@gmail.com"},
+				"pw":          {tt.pw},
+				"consent":     {tt.consent},
+				formCSRFField: {m[1]},
+			}
+			w = postForm(s.Device, "/oauth/device", form, w.Result().Cookies()...)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			_, err := s.Devices.FindByUserCode(userCode)
+			if pending := err == nil; pending != tt.wantPending {
+				t.Errorf("want pending %v, got %v", tt.wantPending, pending)
+			}
+		})
+	}
+}
+
+// TestDeviceCodeGrantOtherClient checks that a device code polled by another client is left for its own client.
+func TestDeviceCodeGrantOtherClient(t *testing.T) {
+
+	s, deviceCode, userCode := deviceServer(t)
+	err := s.Devices.Approve(userCode, "joe.jet@gmail.com", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"grant_type": {grantDeviceCode}, "device_code": {deviceCode}, "client_id": {"consumer-app"}}
+	w := postForm(s.Token, "/oauth/token", form)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("other client: want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	form.Set("client_id", testDeviceClientId)
+	w = postForm(s.Token, "/oauth/token", form)
+	if w.Code != http.StatusOK {
+		t.Fatalf("own client: want status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+// TestDeviceCodeRemoveExpired checks that the expired device authorizations are swept, with their user codes.
+func TestDeviceCodeRemoveExpired(t *testing.T) {
+
+	s, deviceCode, userCode := deviceServer(t)
+
+	if n := s.Devices.RemoveExpired(time.Now()); n != 0 {
+		t.Fatalf("%d unexpired device codes removed", n)
+	}
+	if n := s.Devices.RemoveExpired(time.Now().Add(2 * time.Minute)); n != 1 {
+		t.Fatalf("%d expired device codes removed, want 1", n)
+	}
+
+	_, err := s.Devices.Poll(helpers.HashToken(deviceCode), testDeviceClientId, time.Now())
+	if err != data.ErrDeviceCodeNotFound {
+		t.Errorf("device code: want %v, got %v", data.ErrDeviceCodeNotFound, err)
+	}
+	_, err = s.Devices.FindByUserCode(userCode)
+	if err != data.ErrDeviceCodeNotFound {
+		t.Errorf("user code: want %v, got %v", data.ErrDeviceCodeNotFound, err)
+	}
+}
@@ -0,0 +1,113 @@
+package oauth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-qiu/passer-auth-service/jwt"
+)
+
+// tokenTypeAccessToken is the only token type accepted and issued by the token exchange grant (RFC 8693, section 3).
+const tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// tokenExchangeResponse is the successful response of the token exchange grant (RFC 8693, section 2.2.1).
+type tokenExchangeResponse struct {
+	tokenResponse
+	IssuedTokenType string `json:"issued_token_type"`
+}
+
+// tokenExchangeGrant trades a subject token (e.g. a consumer's access token) for a narrowly scoped token,
+// restricted to an audience (e.g. the parcel service), that the client uses on behalf of the subject (RFC 8693).
+// The issued token carries an 'act' claim identifying the client as the actor.
+func (s *Server) tokenExchangeGrant(w http.ResponseWriter, r *http.Request) {
+
+	client, ok := s.authenticateClient(r)
+	if !ok || client.IsPublic {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	if !client.AllowsGrant(grantTokenExchange) {
+		writeError(w, http.StatusBadRequest, errUnauthorizedClient, "the client is not allowed to use the token exchange grant")
+		return
+	}
+
+	subjectToken := r.PostForm.Get("subject_token")
+	if subjectToken == "" || r.PostForm.Get("subject_token_type") != tokenTypeAccessToken {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "an access_token subject_token is required")
+		return
+	}
+
+	if t := r.PostForm.Get("requested_token_type"); t != "" && t != tokenTypeAccessToken {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "only access_token can be requested")
+		return
+	}
+
+	aud := r.PostForm.Get("audience")
+	if aud == "" || !client.AllowsAudience(aud) {
+		writeError(w, http.StatusBadRequest, errInvalidTarget, "audience is required and must be allowed for the client")
+		return
+	}
+
+	ok, err := jwt.Verify(subjectToken, s.SecretKey)
+	if err != nil || !ok {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "subject_token is invalid or has expired")
+		return
+	}
+	subject, err := jwt.Decode(subjectToken)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "subject_token is invalid or has expired")
+		return
+	}
+
+	// an audience-restricted token cannot be exchanged again for another audience.
+	if subject.Aud != "" {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "subject_token is restricted to another audience")
+		return
+	}
+
+	// the scopes are narrowed to those granted to both the subject token and the client.
+	// the tokens issued by '/auth' (i.e. without a 'client_id') are not restricted by scopes.
+	allowed := client.Scopes
+	if subject.ClientId != "" {
+		allowed = intersect(allowed, strings.Fields(subject.Scope))
+	}
+	scopes := parseScopes(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	if len(scopes) == 0 || len(intersect(scopes, allowed)) != len(scopes) {
+		writeError(w, http.StatusBadRequest, errInvalidScope, "requested scope exceeds the scope of the subject_token or the client")
+		return
+	}
+
+	// the client acts on behalf of the subject, after any prior actor.
+	pl := subject
+	pl.ClientId = client.Id
+	pl.Scope = strings.Join(scopes, " ")
+	pl.Aud = aud
+	pl.Act = &jwt.Actor{Sub: client.Id, Act: subject.Act}
+	if pl.Sub == "" {
+		pl.Sub = subject.Id
+	}
+
+	// the issued token never outlives the subject token (see sign).
+	t, err := s.sign(pl)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	writeToken(w, tokenExchangeResponse{tokenResponse: t, IssuedTokenType: tokenTypeAccessToken})
+}
+
+// intersect returns the elements of a that are also in b.
+func intersect(a []string, b []string) []string {
+	rtn := []string{}
+	for _, v := range a {
+		if hasScope(b, v) {
+			rtn = append(rtn, v)
+		}
+	}
+	return rtn
+}
@@ -0,0 +1,92 @@
+package oauth
+
+import (
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/jwt"
+)
+
+// introspectionResponse is the response of the introspection endpoint (RFC 7662, section 2.2).
+// Only 'active' is set for a token that is not active.
+type introspectionResponse struct {
+	Active    bool       `json:"active"`
+	Scope     string     `json:"scope,omitempty"`
+	ClientId  string     `json:"client_id,omitempty"`
+	Username  string     `json:"username,omitempty"`
+	TokenType string     `json:"token_type,omitempty"`
+	Exp       int64      `json:"exp,omitempty"`
+	Sub       string     `json:"sub,omitempty"`
+	Aud       string     `json:"aud,omitempty"`
+	Iss       string     `json:"iss,omitempty"`
+	Jti       string     `json:"jti,omitempty"`
+	Act       *jwt.Actor `json:"act,omitempty"`
+	Perms     []string   `json:"perms,omitempty"`
+	Org       string     `json:"org,omitempty"`
+}
+
+// Introspect handles the introspection endpoint, '/oauth/introspect' (RFC 7662).
+// A confidential client (e.g. a locker station controller) posts a token, in the 'token' form parameter, to learn if it is active
+// and on whose behalf it acts, e.g. an agent ('act') collecting the parcels of a consumer ('sub') with a delegated token.
+// A token is active when it is valid, has not expired and none of the revokers has revoked it.
+func (s *Server) Introspect(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errInvalidRequest, "the introspection endpoint only accepts 'POST' requests")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "the request body is not a valid form")
+		return
+	}
+
+	client, ok := s.authenticateClient(r)
+	if !ok || client.IsPublic {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "token is required")
+		return
+	}
+
+	ok, err = jwt.Verify(token, s.SecretKey)
+	if err != nil || !ok {
+		writeToken(w, introspectionResponse{Active: false})
+		return
+	}
+	pl, err := jwt.Decode(token)
+	if err != nil || !s.isActive(pl) {
+		writeToken(w, introspectionResponse{Active: false})
+		return
+	}
+
+	writeToken(w, introspectionResponse{
+		Active:    true,
+		Scope:     pl.Scope,
+		ClientId:  pl.ClientId,
+		Username:  pl.Id,
+		TokenType: "Bearer",
+		Exp:       pl.Exp / 1000,
+		Sub:       pl.Subject(),
+		Aud:       pl.Aud,
+		Iss:       pl.Iss,
+		Jti:       pl.Jti,
+		Act:       pl.Act,
+		Perms:     pl.Perms,
+		Org:       pl.Org,
+	})
+}
+
+// isActive checks that none of the revokers has revoked the token.
+func (s *Server) isActive(pl jwt.JWTPayload) bool {
+	for _, revoker := range s.Revokers {
+		if revoker.IsRevoked(pl) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// OpenID Connect scopes.
+const (
+	scopeOpenId  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+)
+
+// supportedScopes are the scopes advertised in the discovery document.
+var supportedScopes = []string{scopeOpenId, scopeProfile, scopeEmail, "users:read", "users:write", "parcels:collect"}
+
+// discovery is the OpenID Provider metadata (OpenID Connect Discovery 1.0, section 3).
+type discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// userClaims are the standard claims (OpenID Connect Core 1.0, section 5.1) of a user, released according to the granted scopes.
+type userClaims struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// idTokenClaims are the claims of an ID token (OpenID Connect Core 1.0, section 2).
+type idTokenClaims struct {
+	Iss      string `json:"iss"`
+	Aud      string `json:"aud"`
+	Exp      int64  `json:"exp"`
+	Iat      int64  `json:"iat"`
+	AuthTime int64  `json:"auth_time"`
+	Nonce    string `json:"nonce,omitempty"`
+	userClaims
+}
+
+// Discovery handles the '/.well-known/openid-configuration' request.
+func (s *Server) Discovery(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	d := discovery{
+		Issuer:                            s.IssuerURL,
+		AuthorizationEndpoint:             s.IssuerURL + "/oauth/authorize",
+		TokenEndpoint:                     s.IssuerURL + "/oauth/token",
+		UserInfoEndpoint:                  s.IssuerURL + "/userinfo",
+		JWKSURI:                           s.IssuerURL + "/.well-known/jwks.json",
+		DeviceAuthorizationEndpoint:       s.IssuerURL + "/oauth/device_authorization",
+		IntrospectionEndpoint:             s.IssuerURL + "/oauth/introspect",
+		ScopesSupported:                   supportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{grantAuthorizationCode, grantClientCredentials, grantDeviceCode, grantTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "given_name", "family_name", "email", "email_verified"},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// JWKS handles the '/.well-known/jwks.json' request, i.e. publishes the public key used to sign the ID tokens.
+func (s *Server) JWKS(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jwt.JWKS{Keys: []jwt.JWK{jwt.NewJWK(s.SigningKey)}})
+}
+
+// UserInfo handles the '/userinfo' request (OpenID Connect Core 1.0, section 5.3).
+// It is used with the ValidateJWT middleware; the access token must have been granted the 'openid' scope.
+func (s *Server) UserInfo(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || !pl.HasScope(scopeOpenId) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	found, err := s.DataStore.FindContext(r.Context(), pl.Sub)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	claims := newUserClaims(found.GetItem().(models.User), strings.Fields(pl.Scope))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(claims)
+}
+
+// issueIdToken generates the ID token of the user, for the client (i.e. audience).
+func (s *Server) issueIdToken(user models.User, clientId string, scopes []string, nonce string, authTime time.Time) (string, error) {
+
+	now := time.Now()
+	claims := idTokenClaims{
+		Iss:        s.IssuerURL,
+		Aud:        clientId,
+		Exp:        now.Add(s.TokenTTL).Unix(),
+		Iat:        now.Unix(),
+		AuthTime:   authTime.Unix(),
+		Nonce:      nonce,
+		userClaims: newUserClaims(user, scopes),
+	}
+
+	return jwt.SignRS256(claims, s.SigningKey, jwt.KeyId(&s.SigningKey.PublicKey))
+}
+
+// newUserClaims returns the claims of the user released by the scopes.
+func newUserClaims(user models.User, scopes []string) userClaims {
+
+	claims := userClaims{Sub: user.Id}
+
+	for _, scope := range scopes {
+		switch scope {
+		case scopeProfile:
+			claims.Name = strings.TrimSpace(user.Name.First + " " + user.Name.Last)
+			claims.GivenName = user.Name.First
+			claims.FamilyName = user.Name.Last
+		case scopeEmail:
+			// an account is only activated once its email is verified (or registered by an admin).
+			verified := user.IsActive
+			claims.Email = user.Email
+			claims.EmailVerified = &verified
+		}
+	}
+
+	return claims
+}
+
+// hasScope checks if the scope is one of the scopes.
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
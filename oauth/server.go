@@ -0,0 +1,230 @@
+/*
+Package oauth is the OAuth 2.0 authorization server of the service.
+It lets the merchant web portals and the consumer mobile app obtain tokens without posting the raw user credentials to '/auth'.
+*/
+package oauth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OAuth 2.0 grant types.
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantClientCredentials = "client_credentials"
+	grantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// OAuth 2.0 error codes (RFC 6749, section 4.1.2.1 and 5.2).
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errInvalidGrant         = "invalid_grant"
+	errInvalidScope         = "invalid_scope"
+	errUnauthorizedClient   = "unauthorized_client"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errUnsupportedRespType  = "unsupported_response_type"
+	errAccessDenied         = "access_denied"
+	errServerError          = "server_error"
+	errInvalidTarget        = "invalid_target"
+
+	// RFC 8628, section 3.5.
+	errAuthorizationPending = "authorization_pending"
+	errSlowDown             = "slow_down"
+	errExpiredToken         = "expired_token"
+)
+
+// Server holds the dependencies of the OAuth 2.0 endpoints.
+type Server struct {
+	DataStore *data.DataStore
+	Clients   *data.ClientStore
+	Codes     *data.AuthCodeStore
+	Roles     *data.RoleStore
+	Orgs      *data.OrganizationStore
+
+	// attributes of the access tokens issued.
+	Issuer    string
+	SecretKey string
+	TokenTTL  time.Duration
+
+	// life span of the authorization codes issued.
+	CodeTTL time.Duration
+
+	// OpenID Connect provider; the issuer url and the key used to sign the ID tokens.
+	IssuerURL  string
+	SigningKey *rsa.PrivateKey
+
+	// device authorization grant; life span of the device codes and the minimum polling interval.
+	Devices            *data.DeviceCodeStore
+	DeviceCodeTTL      time.Duration
+	DevicePollInterval time.Duration
+
+	// token introspection; the stores of the tokens that can be revoked before they expire.
+	Revokers []middlewares.Revoker
+}
+
+// SweepExpired removes the authorization codes and the device codes that have expired without being redeemed, every interval.
+// It runs until the program exits.
+func (s *Server) SweepExpired(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.Codes.RemoveExpired(now)
+		s.Devices.RemoveExpired(now)
+	}
+}
+
+// tokenResponse is the successful response of the token endpoint (RFC 6749, section 5.1).
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IdToken     string `json:"id_token,omitempty"`
+}
+
+// errorResponse is the error response of the token endpoint (RFC 6749, section 5.2).
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// issueAccessToken generates an access token for the user, issued to the client with the scopes.
+func (s *Server) issueAccessToken(user models.User, clientId string, scopes []string) (tokenResponse, error) {
+
+	org, perms := data.ClaimsOf(user, s.Roles, s.Orgs)
+
+	return s.sign(jwt.JWTPayload{
+		Id:       user.Email,
+		Name:     strings.TrimSpace(user.Name.First + " " + user.Name.Last),
+		Roles:    user.Roles,
+		IsActive: user.IsActive,
+		Perms:    perms,
+		Org:      org,
+		Sub:      user.Id,
+		ClientId: clientId,
+		Scope:    strings.Join(scopes, " "),
+	})
+}
+
+// issueClientToken generates an access token for the client itself, with the scopes.
+func (s *Server) issueClientToken(client models.Client, scopes []string) (tokenResponse, error) {
+
+	return s.sign(jwt.JWTPayload{
+		Id:       client.Id,
+		Name:     client.Name,
+		Roles:    []string{},
+		IsActive: true,
+		Sub:      client.Id,
+		ClientId: client.Id,
+		Scope:    strings.Join(scopes, " "),
+	})
+}
+
+// sign sets the issuer and expiry of the payload and generates the access token response.
+// An expiry already set in the payload is kept when it is sooner than the token life span.
+func (s *Server) sign(pl jwt.JWTPayload) (tokenResponse, error) {
+
+	now := time.Now()
+	exp := now.Add(s.TokenTTL).UnixMilli()
+	if pl.Exp == 0 || pl.Exp > exp {
+		pl.Exp = exp
+	}
+	pl.Iss = s.Issuer
+
+	token, err := jwt.Sign(pl, s.SecretKey)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   (pl.Exp - now.UnixMilli()) / 1000,
+		Scope:       pl.Scope,
+	}, nil
+}
+
+// authenticateClient returns the client identified by the request.
+// A confidential client must pass its secret, via HTTP Basic auth or the 'client_secret' form value.
+// A public client only passes its 'client_id'.
+func (s *Server) authenticateClient(r *http.Request) (models.Client, bool) {
+
+	id, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	c, err := s.Clients.Find(id)
+	if err != nil {
+		return models.Client{}, false
+	}
+
+	if c.IsPublic {
+		return c, secret == ""
+	}
+
+	start := time.Now()
+	err = bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret))
+	metrics.BcryptDuration.ObserveSince(start, "compare")
+	if err != nil {
+		return models.Client{}, false
+	}
+
+	return c, true
+}
+
+// writeToken sends the token response, which must not be cached, to the requestor.
+func writeToken(w http.ResponseWriter, t interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(t)
+}
+
+// writeError sends an OAuth 2.0 error response to the requestor.
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if code == errInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: code, ErrorDescription: description})
+}
+
+// parseScopes splits the space-delimited scope value.
+func parseScopes(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// verifyPKCE checks the code verifier against the S256 code challenge (RFC 7636, section 4.6).
+func verifyPKCE(verifier string, challenge string) bool {
+
+	// the verifier must have 43 to 128 characters.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	h := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(h[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
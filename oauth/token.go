@@ -0,0 +1,163 @@
+package oauth
+
+import (
+	"net/http"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// Token handles the token endpoint, '/oauth/token'.
+// The 'POST' request, with a form encoded body, exchanges a grant for an access token.
+func (s *Server) Token(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errInvalidRequest, "the token endpoint only accepts 'POST' requests")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "the request body is not a valid form")
+		return
+	}
+
+	// every grant is recorded in the audit log, by the client, with its outcome.
+	rec := &metrics.StatusRecorder{ResponseWriter: w}
+	w = rec
+	defer func() {
+		outcome := audit.OutcomeSuccess
+		if rec.StatusCode() >= http.StatusBadRequest {
+			outcome = audit.OutcomeFailure
+		}
+		middlewares.AuditAs(r, clientIdOf(r), audit.ActionToken, r.PostForm.Get("grant_type"), outcome)
+	}()
+
+	switch r.PostForm.Get("grant_type") {
+	case grantAuthorizationCode:
+		s.authorizationCodeGrant(w, r)
+	case grantClientCredentials:
+		s.clientCredentialsGrant(w, r)
+	case grantDeviceCode:
+		s.deviceCodeGrant(w, r)
+	case grantTokenExchange:
+		s.tokenExchangeGrant(w, r)
+	case "":
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "grant_type is required")
+	default:
+		writeError(w, http.StatusBadRequest, errUnsupportedGrantType, "")
+	}
+}
+
+// clientIdOf returns the id of the client of the token request, from its basic authentication or else its form.
+func clientIdOf(r *http.Request) string {
+
+	if id, _, ok := r.BasicAuth(); ok {
+		return id
+	}
+
+	return r.PostForm.Get("client_id")
+}
+
+// authorizationCodeGrant exchanges an authorization code, and its PKCE code verifier, for an access token (RFC 6749, section 4.1.3).
+func (s *Server) authorizationCodeGrant(w http.ResponseWriter, r *http.Request) {
+
+	client, ok := s.authenticateClient(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	if !client.AllowsGrant(grantAuthorizationCode) {
+		writeError(w, http.StatusBadRequest, errUnauthorizedClient, "the client is not allowed to use the authorization code grant")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || verifier == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "code and code_verifier are required")
+		return
+	}
+
+	// the code is consumed on the first attempt, whether or not the exchange succeeds.
+	c, err := s.Codes.Consume(helpers.HashToken(code))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "code is invalid or has expired")
+		return
+	}
+
+	if c.ClientId != client.Id || c.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "code was not issued to the client or the redirect_uri")
+		return
+	}
+
+	if !verifyPKCE(verifier, c.CodeChallenge) {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "code_verifier does not match the code_challenge")
+		return
+	}
+
+	found, err := s.DataStore.FindContext(r.Context(), c.UserId)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "the user is no longer registered")
+		return
+	}
+	user := found.GetItem().(models.User)
+	if !user.IsActive {
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "the user is not active")
+		return
+	}
+
+	t, err := s.issueAccessToken(user, client.Id, c.Scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	// OpenID Connect authentication request.
+	if hasScope(c.Scopes, scopeOpenId) {
+		t.IdToken, err = s.issueIdToken(user, client.Id, c.Scopes, c.Nonce, c.AuthTime)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errServerError, "")
+			return
+		}
+	}
+
+	writeToken(w, t)
+}
+
+// clientCredentialsGrant issues an access token to a confidential client acting on its own behalf (RFC 6749, section 4.4).
+// The subject of the token is the client.
+func (s *Server) clientCredentialsGrant(w http.ResponseWriter, r *http.Request) {
+
+	client, ok := s.authenticateClient(r)
+	if !ok || client.IsPublic {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	if !client.AllowsGrant(grantClientCredentials) {
+		writeError(w, http.StatusBadRequest, errUnauthorizedClient, "the client is not allowed to use the client credentials grant")
+		return
+	}
+
+	scopes := parseScopes(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		writeError(w, http.StatusBadRequest, errInvalidScope, "requested scope is not allowed for the client")
+		return
+	}
+
+	t, err := s.issueClientToken(client, scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	writeToken(w, t)
+}
@@ -0,0 +1,249 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+)
+
+const (
+	testClientId    = "consumer-app"
+	testRedirectURI = "sg.passer.app:/oauth/callback"
+)
+
+// testServer returns an authorization server with the preloaded users, roles and clients,
+// and another public client, 'other-app', allowed the authorization code grant.
+func testServer(t *testing.T) *Server {
+	t.Helper()
+
+	ds := data.New()
+	userList, err := helpers.Preload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range userList {
+		ds.InsertNode(u, u.Email)
+	}
+
+	clients := data.NewClientStore()
+	for _, c := range helpers.PreloadClients() {
+		clients.Insert(c)
+	}
+	clients.Insert(models.Client{
+		Id:           "other-app",
+		RedirectURIs: []string{"other.app:/oauth/callback"},
+		Scopes:       []string{"openid", "profile"},
+		GrantTypes:   []string{grantAuthorizationCode},
+		IsPublic:     true,
+	})
+
+	roles := data.NewRoleStore()
+	for _, r := range helpers.PreloadRoles() {
+		err = roles.Insert(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &Server{
+		DataStore: ds,
+		Clients:   clients,
+		Codes:     data.NewAuthCodeStore(),
+		Roles:     roles,
+		Issuer:    "passer",
+		SecretKey: "test.secret.key.of.at.least.32.bytes",
+		TokenTTL:  time.Minute,
+		CodeTTL:   time.Minute,
+	}
+}
+
+// challengeOf returns the S256 code_challenge of the verifier.
+func challengeOf(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// postForm sends the form to the handler, as a 'POST' request with the cookies, and returns the response.
+func postForm(h http.HandlerFunc, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	return w
+}
+
+// TestVerifyPKCE checks the S256 code_verifier against its code_challenge (RFC 7636, section 4.6).
+func TestVerifyPKCE(t *testing.T) {
+
+	verifier := strings.Repeat("v", 43)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "match", verifier: verifier, challenge: challengeOf(verifier), want: true},
+		{name: "longest verifier", verifier: strings.Repeat("v", 128), challenge: challengeOf(strings.Repeat("v", 128)), want: true},
+		{name: "other verifier", verifier: strings.Repeat("w", 43), challenge: challengeOf(verifier), want: false},
+		{name: "plain challenge", verifier: verifier, challenge: verifier, want: false},
+		{name: "verifier too short", verifier: strings.Repeat("v", 42), challenge: challengeOf(strings.Repeat("v", 42)), want: false},
+		{name: "verifier too long", verifier: strings.Repeat("v", 129), challenge: challengeOf(strings.Repeat("v", 129)), want: false},
+		{name: "empty challenge", verifier: verifier, challenge: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestAuthorizationCodeGrant checks that a code is only exchanged by the client it was issued to,
+// with the same redirect_uri and the code_verifier of its code_challenge, and only once.
+func TestAuthorizationCodeGrant(t *testing.T) {
+
+	verifier := strings.Repeat("abcdefgh", 6)
+
+	tests := []struct {
+		name        string
+		clientId    string
+		redirectURI string
+		verifier    string
+		// the number of exchanges of the code, and the status of the last one.
+		uses       int
+		wantStatus int
+	}{
+		{name: "valid", clientId: testClientId, redirectURI: testRedirectURI, verifier: verifier, uses: 1, wantStatus: http.StatusOK},
+		{name: "replayed code", clientId: testClientId, redirectURI: testRedirectURI, verifier: verifier, uses: 2, wantStatus: http.StatusBadRequest},
+		{name: "wrong verifier", clientId: testClientId, redirectURI: testRedirectURI, verifier: strings.Repeat("hgfedcba", 6), uses: 1, wantStatus: http.StatusBadRequest},
+		{name: "missing verifier", clientId: testClientId, redirectURI: testRedirectURI, verifier: "", uses: 1, wantStatus: http.StatusBadRequest},
+		{name: "redirect_uri mismatch", clientId: testClientId, redirectURI: "sg.passer.app:/other", verifier: verifier, uses: 1, wantStatus: http.StatusBadRequest},
+		{name: "missing redirect_uri", clientId: testClientId, redirectURI: "", verifier: verifier, uses: 1, wantStatus: http.StatusBadRequest},
+		{name: "other client", clientId: "other-app", redirectURI: testRedirectURI, verifier: verifier, uses: 1, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := testServer(t)
+			client, _ := s.Clients.Find(testClientId)
+			user := models.User{Id: "jimmy.dean@gmail.com"}
+			params := authorizeRequest{ClientId: testClientId, RedirectURI: testRedirectURI, CodeChallenge: challengeOf(verifier)}
+			code, err := s.issueCode(client, user, params, []string{"profile"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			form := url.Values{
+				"grant_type":    {grantAuthorizationCode},
+				"code":          {code},
+				"client_id":     {tt.clientId},
+				"redirect_uri":  {tt.redirectURI},
+				"code_verifier": {tt.verifier},
+			}
+			var w *httptest.ResponseRecorder
+			for i := 0; i < tt.uses; i++ {
+				w = postForm(s.Token, "/oauth/token", form)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestAuthorizationCodeGrantConsumesCode checks that a failed exchange consumes the code all the same,
+// so a code intercepted by another client cannot be retried with other parameters.
+func TestAuthorizationCodeGrantConsumesCode(t *testing.T) {
+
+	s := testServer(t)
+	verifier := strings.Repeat("abcdefgh", 6)
+	client, _ := s.Clients.Find(testClientId)
+	params := authorizeRequest{ClientId: testClientId, RedirectURI: testRedirectURI, CodeChallenge: challengeOf(verifier)}
+	code, err := s.issueCode(client, models.User{Id: "jimmy.dean@gmail.com"}, params, []string{"profile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"grant_type": {grantAuthorizationCode}, "code": {code}, "client_id": {testClientId}, "redirect_uri": {testRedirectURI}}
+	form.Set("code_verifier", strings.Repeat("hgfedcba", 6))
+	postForm(s.Token, "/oauth/token", form)
+
+	form.Set("code_verifier", verifier)
+	w := postForm(s.Token, "/oauth/token", form)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestAuthorizeCSRF checks that the login form is only accepted with the CSRF token rendered to the same user agent.
+func TestAuthorizeCSRF(t *testing.T) {
+
+	s := testServer(t)
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientId},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"profile"},
+		"code_challenge":        {challengeOf(strings.Repeat("abcdefgh", 6))},
+		"code_challenge_method": {"S256"},
+	}
+
+	w := httptest.NewRecorder()
+	s.Authorize(w, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+q.Encode(), nil))
+	m := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	cookies := w.Result().Cookies()
+	if m == nil || len(cookies) != 1 {
+		t.Fatalf("the login page has no CSRF token or cookie")
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		cookies    []*http.Cookie
+		wantStatus int
+	}{
+		{name: "valid", token: m[1], cookies: cookies, wantStatus: http.StatusFound},
+		{name: "no token", token: "", cookies: cookies, wantStatus: http.StatusForbidden},
+		{name: "no cookie", token: m[1], cookies: nil, wantStatus: http.StatusForbidden},
+		{name: "other cookie", token: m[1], cookies: []*http.Cookie{{Name: formCSRFCookieName, Value: "other"}}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			form := url.Values{}
+			for k, v := range q {
+				form[k] = v
+			}
+			form.Set("email", "jimmy.dean@gmail.com")
+			form.Set("pw", "Testing.12345")
+			form.Set("consent", "allow")
+			form.Set(formCSRFField, tt.token)
+
+			w := postForm(s.Authorize, "/oauth/authorize", form, tt.cookies...)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/mailer"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the minimum number of characters of a new password.
+const minPasswordLength = 8
+
+// maxJSONBodyBytes is the largest request body read by readJSON. the bodies of these endpoints are a few short attributes.
+const maxJSONBodyBytes = 64 << 10
+
+var (
+	ErrInvalidResetToken error = errors.New("[AUTH]: reset token is invalid or has expired")
+	ErrWeakPassword      error = fmt.Errorf("[AUTH]: password must have at least %d characters", minPasswordLength)
+)
+
+// msgResetLinkSent is sent for every forgot password request, so that the response
+// does not reveal whether the email is registered.
+const msgResetLinkSent = "[AUTH]: if the email is registered, a password reset link has been sent to it"
+
+// paramsForgotPassword struct is for holding the '/auth/password/forgot' request body content.
+type paramsForgotPassword struct {
+	Email string `json:"email"`
+}
+
+// paramsResetPassword struct is for holding the '/auth/password/reset' request body content.
+type paramsResetPassword struct {
+	Token string `json:"token"`
+	Pw    string `json:"pw"`
+}
+
+// ForgotPassword is a http handler for the 'POST' request to send a password reset link to the email passed in via the request body.
+// The same response is sent whether or not the email is registered.
+func (a *application) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		errString := fmt.Sprintf("[AUTH]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, errString, nil)
+		return
+	}
+
+	var params paramsForgotPassword
+	err := readJSON(w, r, &params)
+	if err != nil || strings.TrimSpace(params.Email) == "" {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[AUTH]: email is a required attribute", nil)
+		return
+	}
+
+	// the outcome of the lookup is not recorded, as the audit log must not reveal the registered emails either.
+	email := strings.TrimSpace(params.Email)
+	middlewares.AuditAs(r, email, audit.ActionPasswordResetRequest, email, audit.OutcomeSuccess)
+
+	// the lookup and the delivery are done in the background,
+	// so the response time does not depend on the email being registered.
+	// they outlive the request, whose context is cancelled once it is served, so they keep its values only.
+	logger := logging.FromContext(r.Context())
+	ctx := context.WithoutCancel(r.Context())
+	go func(email string) {
+		err := a.sendResetLink(ctx, email)
+		if err != nil {
+			logger.Error("[AUTH]: fail to send the password reset link", logging.FieldError, err)
+		}
+	}(email)
+
+	helpers.WriteJSON(w, http.StatusOK, true, msgResetLinkSent, nil)
+}
+
+// ResetPassword is a http handler for the 'POST' request to set a new password, using the reset token sent by ForgotPassword.
+func (a *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		errString := fmt.Sprintf("[AUTH]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, errString, nil)
+		return
+	}
+
+	var params paramsResetPassword
+	err := readJSON(w, r, &params)
+	if err != nil || strings.TrimSpace(params.Token) == "" {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[AUTH]: token is a required attribute", nil)
+		return
+	}
+
+	// check the new password before the token is consumed.
+	if len(params.Pw) < minPasswordLength {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, ErrWeakPassword.Error(), nil)
+		return
+	}
+
+	userId, err := a.execResetPassword(r.Context(), params.Token, params.Pw)
+	if err != nil {
+		middlewares.AuditAs(r, userId, audit.ActionPasswordReset, userId, audit.OutcomeFailure)
+		if err == ErrInvalidResetToken {
+			helpers.WriteJSON(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		a.serverError(w, r, err)
+		return
+	}
+
+	middlewares.AuditAs(r, userId, audit.ActionPasswordReset, userId, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusOK, true, "[AUTH]: password has been reset", nil)
+}
+
+// sendResetLink issues a reset token for the user registered with email and mails the reset link to the user.
+// Nothing is sent when the email is not registered or the user is not active.
+func (a *application) sendResetLink(ctx context.Context, email string) error {
+
+	found, err := a.dataStore.FindContext(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	user := found.GetItem().(models.User)
+	if !user.IsActive {
+		return nil
+	}
+
+	raw, err := helpers.NewRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	// a new reset token supersedes the outstanding ones.
+	a.tokens.RemoveAll(user.Id, models.PurposePasswordReset)
+	err = a.tokens.Insert(models.Token{
+		Hash:      helpers.HashToken(raw),
+		Purpose:   models.PurposePasswordReset,
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(a.resetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n", user.Name.First)
+	body += "A password reset was requested for your PASSER account.\n"
+	body += fmt.Sprintf("Use the link below, within %d minutes, to set a new password:\n\n", int(a.resetTokenTTL.Minutes()))
+	body += fmt.Sprintf("%s%s\n\n", a.resetURL, raw)
+	body += "If you did not make this request, you can ignore this email.\n"
+
+	return a.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "PASSER password reset",
+		Body:    body,
+	})
+}
+
+// execResetPassword consumes the reset token and replaces the password hash of the user the token was issued to.
+// It returns the id of the user.
+func (a *application) execResetPassword(ctx context.Context, token string, pw string) (string, error) {
+
+	t, err := a.tokens.Consume(helpers.HashToken(token), models.PurposePasswordReset)
+	if err != nil {
+		return "", ErrInvalidResetToken
+	}
+
+	found, err := a.dataStore.FindContext(ctx, t.UserId)
+	if err != nil {
+		return t.UserId, ErrInvalidResetToken
+	}
+
+	user := found.GetItem().(models.User)
+	start := time.Now()
+	pwhash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+	metrics.BcryptDuration.ObserveSince(start, "hash")
+	if err != nil {
+		return user.Id, err
+	}
+	user.PwHash = string(pwhash)
+
+	_, err = a.dataStore.UpdateContext(ctx, user.Email, user)
+	if err != nil {
+		return user.Id, err
+	}
+
+	// any other reset token issued to the user is no longer valid.
+	a.tokens.RemoveAll(user.Id, models.PurposePasswordReset)
+	return user.Id, nil
+}
+
+// readJSON unmarshals the json content of the request body into v.
+// A body larger than maxJSONBodyBytes is not read, as some of the endpoints are open to unauthenticated callers.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	defer r.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
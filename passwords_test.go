@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+)
+
+// resetApp returns an application with the preloaded users and an empty token store, for the password reset tests.
+func resetApp(t *testing.T) *application {
+	t.Helper()
+
+	ds := data.New()
+	userList, err := helpers.Preload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range userList {
+		ds.InsertNode(u, u.Email)
+	}
+
+	return &application{dataStore: ds, tokens: data.NewTokenStore(), resetTokenTTL: 30 * time.Minute}
+}
+
+// issueToken adds a token, raw, to the token store of the application, and returns it.
+func issueToken(t *testing.T, a *application, raw string, purpose string, expiresAt time.Time) string {
+	t.Helper()
+
+	err := a.tokens.Insert(models.Token{
+		Hash:      helpers.HashToken(raw),
+		Purpose:   purpose,
+		UserId:    "xy.lim@bestbuy.com",
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return raw
+}
+
+// TestExecResetPassword checks that a reset token is single-use, expires, and is only accepted for its purpose.
+func TestExecResetPassword(t *testing.T) {
+
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name    string
+		purpose string
+		expires time.Time
+		// the number of resets with the token, and the error of the last one.
+		uses    int
+		wantErr error
+	}{
+		{name: "valid", purpose: models.PurposePasswordReset, expires: later, uses: 1, wantErr: nil},
+		{name: "single use", purpose: models.PurposePasswordReset, expires: later, uses: 2, wantErr: ErrInvalidResetToken},
+		{name: "expired", purpose: models.PurposePasswordReset, expires: earlier, uses: 1, wantErr: ErrInvalidResetToken},
+		{name: "other purpose", purpose: models.PurposeEmailVerification, expires: later, uses: 1, wantErr: ErrInvalidResetToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			a := resetApp(t)
+			raw := issueToken(t, a, "raw-"+strings.ReplaceAll(tt.name, " ", "-"), tt.purpose, tt.expires)
+
+			var err error
+			for i := 0; i < tt.uses; i++ {
+				_, err = a.execResetPassword(context.Background(), raw, "New.Password.1")
+			}
+			if err != tt.wantErr {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestExecResetPasswordOtherPurpose checks that a token of another purpose is left for its own use.
+func TestExecResetPasswordOtherPurpose(t *testing.T) {
+
+	a := resetApp(t)
+	raw := issueToken(t, a, "raw-verification", models.PurposeEmailVerification, time.Now().Add(time.Hour))
+
+	_, err := a.execResetPassword(context.Background(), raw, "New.Password.1")
+	if err != ErrInvalidResetToken {
+		t.Fatalf("want %v, got %v", ErrInvalidResetToken, err)
+	}
+
+	_, err = a.tokens.Consume(helpers.HashToken(raw), models.PurposeEmailVerification)
+	if err != nil {
+		t.Fatalf("the verification token was not left in the store: %v", err)
+	}
+}
+
+// TestResetPasswordBodyLimit checks that a body larger than maxJSONBodyBytes is rejected, not read.
+func TestResetPasswordBodyLimit(t *testing.T) {
+
+	a := resetApp(t)
+	raw := issueToken(t, a, "raw-body-limit", models.PurposePasswordReset, time.Now().Add(time.Hour))
+	body := `{"token": "` + raw + `", "pw": "New.Password.1", "padding": "` + strings.Repeat("x", maxJSONBodyBytes) + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/auth/password/reset", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	a.ResetPassword(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+Package pickup implements the one-time pickup codes of the locker stations.
+
+A pickup code is issued by the service to a user, for a locker, and is signed with an Ed25519 key.
+The locker firmware verifies it offline, with only the public key and a local replay cache (see Verifier),
+so a parcel can still be collected when the locker station has lost its connectivity to the service.
+
+The package only depends on the standard library, so the locker firmware can use it as is.
+
+A code is encoded as a compact token (base64url, for the apps and the NFC readers) or as a QR payload
+(upper case base32 prefixed with "PSR1:", i.e. within the alphanumeric mode of the QR codes).
+Both carry the same bytes:
+
+	version (1) | id (16) | issued at (8) | expires at (8) | user id | locker id | actor id | signature (64)
+
+where the ids are prefixed with their length (1 byte) and the times are in unix seconds.
+*/
+package pickup
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+)
+
+// version is the version of the encoding of the codes.
+const version byte = 1
+
+// QRPrefix is the prefix of the QR payloads.
+const QRPrefix = "PSR1:"
+
+var (
+	ErrMalformed     = errors.New("[Pickup]: code is malformed")
+	ErrBadSignature  = errors.New("[Pickup]: code signature is invalid")
+	ErrExpired       = errors.New("[Pickup]: code has expired")
+	ErrNotYetValid   = errors.New("[Pickup]: code is not yet valid")
+	ErrWrongLocker   = errors.New("[Pickup]: code was issued for another locker")
+	ErrReplayed      = errors.New("[Pickup]: code has already been used")
+	ErrNoReplayCache = errors.New("[Pickup]: the verifier has no replay cache, so the codes cannot be used once only")
+	ErrIdTooLong     = errors.New("[Pickup]: ids must not be longer than 255 bytes")
+	ErrEmptyLockerId = errors.New("[Pickup]: locker id is required")
+	ErrInvalidPEM    = errors.New("[Pickup]: fail to decode the pem encoded key")
+	ErrNotEd25519Key = errors.New("[Pickup]: key is not an Ed25519 key")
+)
+
+var qrEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Claims are the attributes of a pickup code.
+type Claims struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"userId"`
+	LockerId  string    `json:"lockerId"`
+	ActorId   string    `json:"actorId,omitempty"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Code is a signed pickup code, in both its encodings.
+type Code struct {
+	Claims
+	Token string `json:"token"`
+	QR    string `json:"qr"`
+}
+
+// Issuer issues the pickup codes. It runs in the service only, as it holds the private key.
+type Issuer struct {
+	Key ed25519.PrivateKey
+	TTL time.Duration
+}
+
+// Issue issues a code for the user to open the locker, until now + TTL.
+// The actor is the agent collecting on the user's behalf, if any.
+func (iss Issuer) Issue(userId string, lockerId string, actorId string, now time.Time) (Code, error) {
+
+	if lockerId == "" {
+		return Code{}, ErrEmptyLockerId
+	}
+
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return Code{}, err
+	}
+
+	c := Claims{
+		Id:        hex.EncodeToString(id),
+		UserId:    userId,
+		LockerId:  lockerId,
+		ActorId:   actorId,
+		IssuedAt:  now.Truncate(time.Second),
+		ExpiresAt: now.Add(iss.TTL).Truncate(time.Second),
+	}
+
+	msg, err := marshal(c, id)
+	if err != nil {
+		return Code{}, err
+	}
+	raw := append(msg, ed25519.Sign(iss.Key, msg)...)
+
+	return Code{
+		Claims: c,
+		Token:  base64.RawURLEncoding.EncodeToString(raw),
+		QR:     QRPrefix + qrEncoding.EncodeToString(raw),
+	}, nil
+}
+
+// ReplayCache records the codes used at a locker, until they expire, so each code is used once only.
+type ReplayCache interface {
+	// Use records the code with the id, which expires at exp.
+	// It returns false when the code has already been used.
+	Use(id string, exp time.Time) bool
+}
+
+// Verifier verifies the pickup codes presented at a locker, offline.
+type Verifier struct {
+	PublicKey ed25519.PublicKey
+	LockerId  string
+	// required: a verifier without a replay cache refuses every code (see ErrNoReplayCache).
+	Replay ReplayCache
+
+	// tolerance for the drift of the locker's clock.
+	Leeway time.Duration
+}
+
+// Verify checks that the code (either a token or a QR payload) was signed by the service, for this locker,
+// is valid at time, now, and has not been used before. The code is used (recorded in the replay cache) when it is valid.
+func (v Verifier) Verify(code string, now time.Time) (Claims, error) {
+
+	if v.Replay == nil {
+		return Claims{}, ErrNoReplayCache
+	}
+
+	raw, err := decode(code)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if len(raw) <= ed25519.SignatureSize {
+		return Claims{}, ErrMalformed
+	}
+	msg, sig := raw[:len(raw)-ed25519.SignatureSize], raw[len(raw)-ed25519.SignatureSize:]
+	if !ed25519.Verify(v.PublicKey, msg, sig) {
+		return Claims{}, ErrBadSignature
+	}
+
+	c, err := unmarshal(msg)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if now.Add(v.Leeway).Before(c.IssuedAt) {
+		return Claims{}, ErrNotYetValid
+	}
+	if !now.Add(-v.Leeway).Before(c.ExpiresAt) {
+		return Claims{}, ErrExpired
+	}
+	if c.LockerId != v.LockerId {
+		return Claims{}, ErrWrongLocker
+	}
+
+	// the code is kept in the cache past its expiry by the leeway, as it is accepted for that long.
+	if !v.Replay.Use(c.Id, c.ExpiresAt.Add(v.Leeway)) {
+		return Claims{}, ErrReplayed
+	}
+
+	return c, nil
+}
+
+// decode returns the bytes of the code, in either encoding.
+func decode(code string) ([]byte, error) {
+
+	code = strings.TrimSpace(code)
+
+	var raw []byte
+	var err error
+	if strings.HasPrefix(code, QRPrefix) {
+		raw, err = qrEncoding.DecodeString(strings.TrimPrefix(code, QRPrefix))
+	} else {
+		raw, err = base64.RawURLEncoding.DecodeString(code)
+	}
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	return raw, nil
+}
+
+// marshal encodes the claims, with the id in bytes, to be signed.
+func marshal(c Claims, id []byte) ([]byte, error) {
+
+	b := make([]byte, 1+16+8+8)
+	b[0] = version
+	copy(b[1:17], id)
+	binary.BigEndian.PutUint64(b[17:25], uint64(c.IssuedAt.Unix()))
+	binary.BigEndian.PutUint64(b[25:33], uint64(c.ExpiresAt.Unix()))
+
+	for _, s := range []string{c.UserId, c.LockerId, c.ActorId} {
+		if len(s) > 255 {
+			return nil, ErrIdTooLong
+		}
+		b = append(b, byte(len(s)))
+		b = append(b, s...)
+	}
+
+	return b, nil
+}
+
+// unmarshal decodes the claims signed.
+func unmarshal(b []byte) (Claims, error) {
+
+	if len(b) < 1+16+8+8 || b[0] != version {
+		return Claims{}, ErrMalformed
+	}
+
+	c := Claims{
+		Id:        hex.EncodeToString(b[1:17]),
+		IssuedAt:  time.Unix(int64(binary.BigEndian.Uint64(b[17:25])), 0),
+		ExpiresAt: time.Unix(int64(binary.BigEndian.Uint64(b[25:33])), 0),
+	}
+
+	rest := b[33:]
+	ids := make([]string, 3)
+	for i := range ids {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return Claims{}, ErrMalformed
+		}
+		ids[i] = string(rest[1 : 1+int(rest[0])])
+		rest = rest[1+int(rest[0]):]
+	}
+	if len(rest) != 0 {
+		return Claims{}, ErrMalformed
+	}
+	c.UserId, c.LockerId, c.ActorId = ids[0], ids[1], ids[2]
+
+	return c, nil
+}
+
+// ParsePrivateKey returns the Ed25519 private key in the pem encoded (PKCS #8) key.
+func ParsePrivateKey(b []byte) (ed25519.PrivateKey, error) {
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrNotEd25519Key
+	}
+
+	return key, nil
+}
+
+// ParsePublicKey returns the Ed25519 public key in the pem encoded (PKIX) key, e.g. as provisioned in the locker firmware.
+func ParsePublicKey(b []byte) (ed25519.PublicKey, error) {
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrNotEd25519Key
+	}
+
+	return key, nil
+}
+
+// MarshalPublicKey returns the pem encoded (PKIX) public key, for provisioning the locker firmware.
+func MarshalPublicKey(key ed25519.PublicKey) ([]byte, error) {
+
+	b, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}), nil
+}
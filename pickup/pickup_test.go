@@ -0,0 +1,351 @@
+package pickup
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLockerId = "locker-station-01"
+
+// newKey returns a new Ed25519 key, failing the test on an error.
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// newVerifier returns a verifier of the codes signed with the key, at the test locker, with its own replay cache.
+func newVerifier(key ed25519.PrivateKey, leeway time.Duration) Verifier {
+	return Verifier{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		LockerId:  testLockerId,
+		Replay:    NewMemoryReplayCache(),
+		Leeway:    leeway,
+	}
+}
+
+// resign returns the token of the code, raw, with its message altered by alter and signed again with the key.
+func resign(raw []byte, key ed25519.PrivateKey, alter func(msg []byte) []byte) string {
+
+	msg := alter(append([]byte{}, raw[:len(raw)-ed25519.SignatureSize]...))
+	return base64.RawURLEncoding.EncodeToString(append(msg, ed25519.Sign(key, msg)...))
+}
+
+// TestIssueVerify checks that a code is verified, with its claims, in both its encodings.
+func TestIssueVerify(t *testing.T) {
+
+	key := newKey(t)
+	now := time.Now()
+	iss := Issuer{Key: key, TTL: 10 * time.Minute}
+
+	code, err := iss.Issue("jimmy.dean@gmail.com", testLockerId, "joe.jet@gmail.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{name: "token", code: code.Token},
+		{name: "qr", code: code.QR},
+		{name: "token with whitespace", code: " " + code.Token + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c, err := newVerifier(key, 0).Verify(tt.code, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.IssuedAt.Equal(code.IssuedAt) || !c.ExpiresAt.Equal(code.ExpiresAt) {
+				t.Errorf("times: want %v - %v, got %v - %v", code.IssuedAt, code.ExpiresAt, c.IssuedAt, c.ExpiresAt)
+			}
+			c.IssuedAt, c.ExpiresAt = code.IssuedAt, code.ExpiresAt
+			if c != code.Claims {
+				t.Errorf("claims: want %+v, got %+v", code.Claims, c)
+			}
+		})
+	}
+
+	if !strings.HasPrefix(code.QR, QRPrefix) || strings.ToUpper(code.QR) != code.QR {
+		t.Errorf("the QR payload, %s, is not upper case prefixed with %s", code.QR, QRPrefix)
+	}
+}
+
+// TestVerifyRejects checks that the codes that were not signed by the service, for this locker, at this time, are rejected.
+func TestVerifyRejects(t *testing.T) {
+
+	key := newKey(t)
+	now := time.Now()
+	code, err := Issuer{Key: key, TTL: 10 * time.Minute}.Issue("jimmy.dean@gmail.com", testLockerId, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(code.Token)
+
+	tampered := append([]byte{}, raw...)
+	tampered[len(tampered)-ed25519.SignatureSize-1] ^= 0x01
+
+	otherLocker, err := Issuer{Key: key, TTL: 10 * time.Minute}.Issue("jimmy.dean@gmail.com", "locker-station-02", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := Issuer{Key: newKey(t), TTL: 10 * time.Minute}.Issue("jimmy.dean@gmail.com", testLockerId, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a character of the QR payload within the claims.
+	i := len(QRPrefix) + 20
+
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{name: "tampered bytes", code: base64.RawURLEncoding.EncodeToString(tampered), want: ErrBadSignature},
+		{name: "tampered QR", code: code.QR[:i] + nextChar(code.QR[i]) + code.QR[i+1:], want: ErrBadSignature},
+		{name: "truncated signature", code: base64.RawURLEncoding.EncodeToString(raw[:len(raw)-1]), want: ErrBadSignature},
+		{name: "signature only", code: base64.RawURLEncoding.EncodeToString(raw[len(raw)-ed25519.SignatureSize:]), want: ErrMalformed},
+		{name: "not base64", code: "!" + code.Token, want: ErrMalformed},
+		{name: "not base32", code: QRPrefix + "1" + strings.TrimPrefix(code.QR, QRPrefix), want: ErrMalformed},
+		{name: "empty", code: "", want: ErrMalformed},
+		{name: "wrong key", code: otherKey.Token, want: ErrBadSignature},
+		{name: "wrong locker", code: otherLocker.Token, want: ErrWrongLocker},
+		{name: "other version", code: resign(raw, key, func(msg []byte) []byte { msg[0] = version + 1; return msg }), want: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newVerifier(key, 0).Verify(tt.code, now)
+			if err != tt.want {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// nextChar returns another character of the base32 alphabet than c.
+func nextChar(c byte) string {
+	if c == 'A' {
+		return "B"
+	}
+	return "A"
+}
+
+// TestVerifyValidity checks the validity window of a code, with the leeway for the drift of the locker's clock.
+func TestVerifyValidity(t *testing.T) {
+
+	key := newKey(t)
+	issuedAt := time.Now().Truncate(time.Second)
+	ttl := 10 * time.Minute
+	leeway := 30 * time.Second
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		leeway time.Duration
+		want   error
+	}{
+		{name: "at issue", now: issuedAt, want: nil},
+		{name: "before expiry", now: issuedAt.Add(ttl - time.Second), want: nil},
+		{name: "at expiry", now: issuedAt.Add(ttl), want: ErrExpired},
+		{name: "after expiry", now: issuedAt.Add(ttl + time.Second), want: ErrExpired},
+		{name: "after expiry, within the leeway", now: issuedAt.Add(ttl + leeway - time.Second), leeway: leeway, want: nil},
+		{name: "after expiry, beyond the leeway", now: issuedAt.Add(ttl + leeway), leeway: leeway, want: ErrExpired},
+		{name: "before issue", now: issuedAt.Add(-time.Second), want: ErrNotYetValid},
+		{name: "before issue, within the leeway", now: issuedAt.Add(-leeway), leeway: leeway, want: nil},
+		{name: "before issue, beyond the leeway", now: issuedAt.Add(-leeway - time.Second), leeway: leeway, want: ErrNotYetValid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			code, err := Issuer{Key: key, TTL: ttl}.Issue("jimmy.dean@gmail.com", testLockerId, "", issuedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = newVerifier(key, tt.leeway).Verify(code.Token, tt.now)
+			if err != tt.want {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestVerifyReplay checks that a code is used once only at a locker, in either encoding.
+func TestVerifyReplay(t *testing.T) {
+
+	key := newKey(t)
+	now := time.Now()
+	code, err := Issuer{Key: key, TTL: 10 * time.Minute}.Issue("jimmy.dean@gmail.com", testLockerId, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := newVerifier(key, 0)
+	_, err = v.Verify(code.Token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{code.Token, code.QR} {
+		_, err = v.Verify(c, now)
+		if err != ErrReplayed {
+			t.Errorf("want %v, got %v", ErrReplayed, err)
+		}
+	}
+
+	// a code rejected for another reason is not used.
+	fresh, err := Issuer{Key: key, TTL: 10 * time.Minute}.Issue("jimmy.dean@gmail.com", testLockerId, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Verify(fresh.Token, now.Add(time.Hour))
+	if err != ErrExpired {
+		t.Fatalf("want %v, got %v", ErrExpired, err)
+	}
+	_, err = v.Verify(fresh.Token, now)
+	if err != nil {
+		t.Errorf("the code rejected as expired was used: %v", err)
+	}
+}
+
+// TestIssueIds checks the ids accepted in a code.
+func TestIssueIds(t *testing.T) {
+
+	key := newKey(t)
+	long := strings.Repeat("u", 255)
+
+	tests := []struct {
+		name     string
+		userId   string
+		lockerId string
+		actorId  string
+		want     error
+	}{
+		{name: "longest ids", userId: long, lockerId: testLockerId, actorId: long, want: nil},
+		{name: "user id too long", userId: long + "u", lockerId: testLockerId, want: ErrIdTooLong},
+		{name: "actor id too long", userId: "jimmy.dean@gmail.com", lockerId: testLockerId, actorId: long + "u", want: ErrIdTooLong},
+		{name: "empty locker id", userId: "jimmy.dean@gmail.com", lockerId: "", want: ErrEmptyLockerId},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Issuer{Key: key, TTL: time.Minute}.Issue(tt.userId, tt.lockerId, tt.actorId, time.Now())
+			if err != tt.want {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestUnmarshal checks that the length-prefixed ids of the signed bytes are decoded, and that truncated or oversized ids are rejected.
+func TestUnmarshal(t *testing.T) {
+
+	header := make([]byte, 1+16+8+8)
+	header[0] = version
+
+	// msg returns the header followed by the bytes.
+	msg := func(b ...byte) []byte {
+		return append(append([]byte{}, header...), b...)
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    []string
+		wantErr error
+	}{
+		{name: "ids", b: msg(1, 'u', 2, 'l', '1', 0), want: []string{"u", "l1", ""}},
+		{name: "empty ids", b: msg(0, 0, 0), want: []string{"", "", ""}},
+		{name: "header only", b: msg(), wantErr: ErrMalformed},
+		{name: "truncated header", b: header[:len(header)-1], wantErr: ErrMalformed},
+		{name: "empty", b: []byte{}, wantErr: ErrMalformed},
+		{name: "missing actor id", b: msg(1, 'u', 1, 'l'), wantErr: ErrMalformed},
+		{name: "truncated id", b: msg(1, 'u', 5, 'l', '1', 0), wantErr: ErrMalformed},
+		{name: "oversized id length", b: msg(255, 'u', 0, 0), wantErr: ErrMalformed},
+		{name: "trailing bytes", b: msg(1, 'u', 1, 'l', 0, 'x'), wantErr: ErrMalformed},
+		{name: "other version", b: append([]byte{version + 1}, msg(0, 0, 0)[1:]...), wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c, err := unmarshal(tt.b)
+			if err != tt.wantErr {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			got := []string{c.UserId, c.LockerId, c.ActorId}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("ids: want %q, got %q", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestMarshalRoundTrip checks that the claims are decoded as they were encoded.
+func TestMarshalRoundTrip(t *testing.T) {
+
+	id := bytes.Repeat([]byte{0xab}, 16)
+	c := Claims{
+		Id:        strings.Repeat("ab", 16),
+		UserId:    "jimmy.dean@gmail.com",
+		LockerId:  testLockerId,
+		ActorId:   "joe.jet@gmail.com",
+		IssuedAt:  time.Unix(1700000000, 0),
+		ExpiresAt: time.Unix(1700000600, 0),
+	}
+
+	b, err := marshal(c, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != c {
+		t.Errorf("want %+v, got %+v", c, got)
+	}
+}
+
+// TestVerifyNoReplayCache checks that a verifier without a replay cache refuses a valid code, as it could not use it once only.
+func TestVerifyNoReplayCache(t *testing.T) {
+
+	key := newKey(t)
+	now := time.Now()
+	code, err := Issuer{Key: key, TTL: 10 * time.Minute}.Issue("jimmy.dean@gmail.com", testLockerId, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := newVerifier(key, 0)
+	v.Replay = nil
+	for i := 0; i < 2; i++ {
+		_, err = v.Verify(code.Token, now)
+		if err != ErrNoReplayCache {
+			t.Errorf("want %v, got %v", ErrNoReplayCache, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package pickup
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryReplayCache is a ReplayCache held in memory, for the lockers without a persistent storage.
+// The codes are forgotten once they expire, so the cache does not grow beyond the codes in force.
+type MemoryReplayCache struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewMemoryReplayCache instantiates an empty MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{used: map[string]time.Time{}}
+}
+
+// Use records the code with the id, which expires at exp. It returns false when the code has already been used.
+func (c *MemoryReplayCache) Use(id string, exp time.Time) bool {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range c.used {
+		if !now.Before(e) {
+			delete(c.used, k)
+		}
+	}
+
+	if _, ok := c.used[id]; ok {
+		return false
+	}
+
+	c.used[id] = exp
+	return true
+}
@@ -0,0 +1,35 @@
+package pickup
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMemoryReplayCache checks that a code is used once only until it expires, and is forgotten afterwards.
+func TestMemoryReplayCache(t *testing.T) {
+
+	c := NewMemoryReplayCache()
+	exp := time.Now().Add(time.Minute)
+
+	if !c.Use("a", exp) {
+		t.Fatal("first use of a: want true")
+	}
+	if c.Use("a", exp) {
+		t.Error("second use of a: want false")
+	}
+	if !c.Use("b", exp) {
+		t.Error("first use of b: want true")
+	}
+
+	// an expired code is removed on the next use.
+	if !c.Use("c", time.Now().Add(-time.Second)) {
+		t.Fatal("first use of c: want true")
+	}
+	c.Use("d", exp)
+	if _, ok := c.used["c"]; ok {
+		t.Error("the expired code, c, is still held")
+	}
+	if _, ok := c.used["a"]; !ok {
+		t.Error("the code in force, a, was removed")
+	}
+}
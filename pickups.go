@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/pickup"
+	"github.com/go-qiu/passer-auth-service/users"
+)
+
+// paramsPickupCode struct is for holding the 'POST /pickups/codes' request body content.
+type paramsPickupCode struct {
+	LockerId string `json:"lockerId"`
+}
+
+// pickupKey is the public key verifying the pickup codes, as a JSON Web Key (RFC 8037) and pem encoded.
+type pickupKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Alg string `json:"alg"`
+	X   string `json:"x"`
+	PEM string `json:"pem"`
+}
+
+// PickupCode is a http handler for the 'POST' request of a consumer, or of an agent with a delegated token,
+// to get a one-time pickup code for a locker. The code can be verified offline by the locker (see package pickup).
+// It is used with the Authenticate middleware.
+func (a *application) PickupCode(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		errString := fmt.Sprintf("[Pickup]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, errString, nil)
+		return
+	}
+
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || !(middlewares.Granted(pl, models.PermParcelsRead) || middlewares.Granted(pl, models.PermParcelsCollect)) {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Pickup]: only a consumer or an agent can get a pickup code", nil)
+		return
+	}
+
+	// an agent collects on behalf of the consumer with a delegated token only; an impersonating admin cannot open a locker.
+	actorId := ""
+	if pl.Act != nil {
+		if pl.ClientId != users.DelegationClientId {
+			helpers.WriteJSON(w, http.StatusForbidden, false, "[Pickup]: pickup codes can only be issued to the user's own or a delegated token", nil)
+			return
+		}
+		actorId = pl.Act.Sub
+	}
+
+	var params paramsPickupCode
+	err := readJSON(w, r, &params)
+	if err != nil || strings.TrimSpace(params.LockerId) == "" {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Pickup]: lockerId is a required attribute", nil)
+		return
+	}
+
+	code, err := a.pickups.Issue(pl.Subject(), strings.TrimSpace(params.LockerId), actorId, time.Now())
+	if err == pickup.ErrIdTooLong {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Pickup]: pickup code issued. it can be used once only", code)
+}
+
+// PickupKey is a http handler for the 'GET' request of the public key verifying the pickup codes, for provisioning the lockers.
+func (a *application) PickupKey(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		errString := fmt.Sprintf("[Pickup]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, errString, nil)
+		return
+	}
+
+	pub := a.pickups.Key.Public().(ed25519.PublicKey)
+	b, err := pickup.MarshalPublicKey(pub)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, true, "[Pickup]: public key of the pickup codes", pickupKey{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		Alg: "EdDSA",
+		X:   base64.RawURLEncoding.EncodeToString(pub),
+		PEM: string(b),
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestPickupCodeScopes checks that a pickup code is only issued to a token granting the parcels permissions, within its scopes.
+func TestPickupCodeScopes(t *testing.T) {
+
+	h := routedApp(t)
+	consumer := signIn(t, h, "jimmy.dean@gmail.com", "Testing.12345")
+	collectKey := createAPIKey(t, h, consumer, `"parcels:collect"`)
+	admin := signIn(t, h, "admin@passer.com", "pA22er.54321")
+	usersKey := createAPIKey(t, h, admin, `"users:read"`)
+
+	tests := []struct {
+		name       string
+		credential string
+		wantStatus int
+	}{
+		{name: "consumer token", credential: consumer, wantStatus: http.StatusCreated},
+		{name: "key scoped to the parcels", credential: collectKey, wantStatus: http.StatusCreated},
+		{name: "key scoped to the users", credential: usersKey, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(h, http.MethodPost, "/pickups/codes", "Bearer "+tt.credential, `{"lockerId":"locker-01"}`)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
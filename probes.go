@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/config"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/metrics"
+)
+
+// buildTime is the time of the build, set with '-ldflags "-X main.buildTime=..."'.
+// The time of the commit is reported when it is not set.
+var buildTime string
+
+// probes are the paths of the probes of the orchestrator. They are served before the web application,
+// so they need no token and are kept out of the access log (see server.ServeHTTP).
+// The metrics are not among them: they are served on their own listener (see serveMetrics).
+var probes = map[string]func(s *server, w http.ResponseWriter, r *http.Request){
+	"/healthz": (*server).healthz,
+	"/readyz":  (*server).readyz,
+	"/version": (*server).version,
+}
+
+// serveMetrics serves '/metrics' on the plain http server at addr, apart from the public https server,
+// so only the scrapers that reach addr (e.g. on the loopback or the private network) read them.
+// It returns the server, or nil when addr is empty, i.e. the metrics are not served.
+func (s *server) serveMetrics(addr string) *http.Server {
+
+	if addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	srv := &http.Server{
+		Addr:              addr,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelError),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := srv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal(s.logger, err)
+		}
+	}()
+	s.logger.Info("[Server]: metrics server started and listening", "addr", "http://"+addr+"/metrics")
+
+	return srv
+}
+
+// readiness is the response of '/readyz', with the outcome of each check.
+type readiness struct {
+	Config      string `json:"config"`
+	Store       string `json:"store"`
+	SigningKeys string `json:"signingKeys"`
+	Server      string `json:"server"`
+}
+
+// buildInfo is the response of '/version'.
+type buildInfo struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Modified  bool   `json:"modified"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// healthz handles the liveness probe. The process is alive as long as it serves it.
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteJSON(w, http.StatusOK, true, "[Server]: alive", nil)
+}
+
+// readyz handles the readiness probe of the load balancers. The server is ready when the configuration is loaded,
+// the stores are recovered and the signing keys are available, until it is shutting down.
+func (s *server) readyz(w http.ResponseWriter, r *http.Request) {
+
+	const ok, failed = "ok", "failed"
+	check := readiness{Config: ok, Store: ok, SigningKeys: ok, Server: ok}
+	ready := true
+
+	var cfg *config.Config
+	if s.config != nil {
+		cfg = s.config.Current()
+	}
+	if cfg == nil {
+		check.Config, ready = failed, false
+	}
+
+	if s.stores == nil || ds == nil {
+		check.Store, ready = failed, false
+	}
+
+	a := s.app()
+	if cfg == nil || a == nil || len(cfg.JWTSecretKey) < config.MinSecretKeyLength || a.oauth.SigningKey == nil || a.pickups.Key == nil {
+		check.SigningKeys, ready = failed, false
+	}
+
+	if atomic.LoadInt32(&s.draining) == 1 {
+		check.Server, ready = "shutting down", false
+	}
+
+	if !ready {
+		helpers.WriteJSON(w, http.StatusServiceUnavailable, false, "[Server]: not ready", check)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, true, "[Server]: ready", check)
+}
+
+// version handles the request for the build of the service, as recorded by the Go toolchain.
+func (s *server) version(w http.ResponseWriter, r *http.Request) {
+
+	info := buildInfo{BuildTime: buildTime, GoVersion: runtime.Version()}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		info.Version = bi.Main.Version
+		info.GoVersion = bi.GoVersion
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, true, "[Server]: version", info)
+}
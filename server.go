@@ -0,0 +1,522 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/authz"
+	"github.com/go-qiu/passer-auth-service/config"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/mailer"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"github.com/go-qiu/passer-auth-service/oauth"
+	"github.com/go-qiu/passer-auth-service/pickup"
+	"github.com/go-qiu/passer-auth-service/tracing"
+	"github.com/go-qiu/passer-auth-service/users"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// stores struct holds the data stores of the web application, which outlive the reloads of the configuration.
+type stores struct {
+	tokens         *data.TokenStore
+	clients        *data.ClientStore
+	roles          *data.RoleStore
+	orgs           *data.OrganizationStore
+	codes          *data.AuthCodeStore
+	devices        *data.DeviceCodeStore
+	apiKeys        *data.APIKeyStore
+	impersonations *data.ImpersonationStore
+	delegations    *data.DelegationStore
+	sessions       *data.SessionStore
+}
+
+// newStores instantiates the data stores, with the preloaded OAuth 2.0 clients, roles and organizations.
+func newStores() (*stores, error) {
+
+	st := &stores{
+		// the single-use tokens (password reset, email verification) are kept in the same store.
+		tokens:         data.NewTokenStore(),
+		clients:        data.NewClientStore(),
+		roles:          data.NewRoleStore(),
+		orgs:           data.NewOrganizationStore(),
+		codes:          data.NewAuthCodeStore(),
+		devices:        data.NewDeviceCodeStore(),
+		apiKeys:        data.NewAPIKeyStore(),
+		impersonations: data.NewImpersonationStore(),
+		delegations:    data.NewDelegationStore(),
+		sessions:       data.NewSessionStore(),
+	}
+
+	// register the OAuth 2.0 clients.
+	for _, c := range helpers.PreloadClients() {
+		st.clients.Insert(c)
+	}
+
+	// define the roles, i.e. the permission sets assigned to the users.
+	for _, r := range helpers.PreloadRoles() {
+		err := st.roles.Insert(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// register the organizations, i.e. the merchants, with their owners.
+	orgList, memberships := helpers.PreloadOrganizations()
+	for _, o := range orgList {
+		st.orgs.Insert(o)
+	}
+	for _, m := range memberships {
+		err := st.orgs.Join(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
+
+// server struct serves the web application built with the configuration in force.
+// On a reload, a new web application is built, on the same stores, and takes over the new requests,
+// while the requests in flight are completed by the previous one.
+type server struct {
+	config *config.Holder
+	stores *stores
+	logger *slog.Logger
+
+	// the level of the logger, set by the configuration in force.
+	logLevel *slog.LevelVar
+
+	// the audit log of the security events, opened at startup.
+	auditLog *audit.Log
+
+	// the web application in force (*application).
+	current atomic.Value
+
+	// set (to 1) once the server is shutting down.
+	draining int32
+}
+
+// ServeHTTP directs the request to the web application in force.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if probe, ok := probes[r.URL.Path]; ok {
+		probe(s, w, r)
+		return
+	}
+
+	s.app().handler.ServeHTTP(w, r)
+}
+
+// shutdownOnSignal shuts the https server, srv, down gracefully on SIGTERM or SIGINT.
+// The server fails its readiness and keeps serving for the grace period, so the load balancers stop routing to it;
+// then it stops accepting new connections and waits for the requests in flight, until the drain timeout.
+// It returns once the server has shut down and the stores have been flushed. A second signal exits at once.
+func (s *server) shutdownOnSignal(srv *http.Server) {
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	received := <-sig
+	signal.Stop(sig)
+
+	cfg := s.config.Current()
+	s.logger.Info("[Server]: shutting down", "signal", received.String(), "grace", cfg.ShutdownGrace.String(), "drain_timeout", cfg.ShutdownTimeout.String())
+
+	atomic.StoreInt32(&s.draining, 1)
+	srv.SetKeepAlivesEnabled(false)
+	time.Sleep(cfg.ShutdownGrace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		s.logger.Error("[Server]: fail to drain the requests in flight", logging.FieldError, err)
+		srv.Close()
+	}
+
+	s.flush()
+
+	// export the spans still held, e.g. to the collector.
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err = tracing.Shutdown(ctx)
+	if err != nil {
+		s.logger.Error("[Server]: fail to export the trace spans", logging.FieldError, err)
+	}
+}
+
+// flush flushes the audit log, and the stores that hold writes not yet persisted (see data.Flusher).
+func (s *server) flush() {
+
+	all := []interface{}{
+		s.auditLog, ds, s.stores.tokens, s.stores.clients, s.stores.roles, s.stores.orgs, s.stores.codes,
+		s.stores.devices, s.stores.apiKeys, s.stores.impersonations, s.stores.delegations, s.stores.sessions,
+	}
+
+	for _, store := range all {
+		if f, ok := store.(data.Flusher); ok {
+			err := f.Flush()
+			if err != nil {
+				s.logger.Error("[Server]: fail to flush a store", logging.FieldError, err)
+			}
+		}
+	}
+}
+
+// app returns the web application in force.
+func (s *server) app() *application {
+	a, _ := s.current.Load().(*application)
+	return a
+}
+
+// apply builds the web application with the configuration, cfg, and puts it in force.
+// It is called by the config.Holder, on the first load and on every reload of the configuration.
+func (s *server) apply(cfg *config.Config) error {
+
+	prev := s.app()
+	if prev != nil && prev.config.ServerAddr != cfg.ServerAddr {
+		s.logger.Warn("[Config]: SERVER_ADDR changed. it is only applied on a restart", "server_addr", cfg.ServerAddr)
+	}
+	if prev != nil && prev.config.MetricsAddr != cfg.MetricsAddr {
+		s.logger.Warn("[Config]: METRICS_ADDR changed. it is only applied on a restart", "metrics_addr", cfg.MetricsAddr)
+	}
+	if prev != nil && prev.config.AuditLogFile != cfg.AuditLogFile {
+		s.logger.Warn("[Config]: AUDIT_LOG_FILE changed. it is only applied on a restart", "audit_log_file", cfg.AuditLogFile)
+	}
+
+	hashes, err := s.clientSecretHashes(cfg.OAuthClientSecrets)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApplication(cfg, s.stores, prev, s.logger)
+	if err != nil {
+		return err
+	}
+
+	// the exporter is only replaced when its settings change, so the spans of the requests in flight are not dropped.
+	var exporter tracing.Exporter
+	if prev == nil || prev.config.TraceExporter != cfg.TraceExporter || prev.config.TraceOTLPEndpoint != cfg.TraceOTLPEndpoint {
+		exporter, err = traceExporter(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range s.stores.clients.List() {
+		if c.IsPublic {
+			continue
+		}
+		if _, ok := hashes[c.Id]; !ok {
+			s.logger.Warn("[Config]: no secret is set for the confidential client. it cannot authenticate", "client_id", c.Id)
+		}
+		// a client without a secret is left with an empty hash, which matches no secret.
+		s.stores.clients.SetSecretHash(c.Id, hashes[c.Id])
+	}
+
+	s.logLevel.Set(cfg.LogLevel)
+	if exporter != nil {
+		tracing.SetExporter(exporter)
+	}
+	s.current.Store(a)
+	return nil
+}
+
+// clientSecretHashes returns the bcrypt hashes of the secrets of the confidential OAuth 2.0 clients, by their id.
+// It fails when a secret is set for a client that is not registered, or is public.
+func (s *server) clientSecretHashes(secrets map[string]string) (map[string]string, error) {
+
+	hashes := map[string]string{}
+	for id, secret := range secrets {
+		c, err := s.stores.clients.Find(id)
+		if err != nil || c.IsPublic {
+			return nil, fmt.Errorf("[Config]: OAUTH_CLIENT_SECRETS: %s is not a registered confidential client", id)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		hashes[id] = string(hash)
+	}
+
+	return hashes, nil
+}
+
+// traceExporter returns the exporter of the spans of the settings, TRACE_EXPORTER and TRACE_OTLP_ENDPOINT.
+func traceExporter(cfg *config.Config) (tracing.Exporter, error) {
+
+	switch cfg.TraceExporter {
+	case "stdout":
+		return tracing.NewStdoutExporter(os.Stdout)
+	case "otlp":
+		exporter, err := tracing.NewOTLPExporter(cfg.TraceOTLPEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("[Config]: fail to set up the OTLP exporter of the trace spans: %w", err)
+		}
+		return exporter, nil
+	}
+
+	return tracing.NopExporter{}, nil
+}
+
+// watch reloads the configuration on SIGHUP, or when its files have changed, checked every interval.
+// It runs until the program exits.
+func (s *server) watch(interval time.Duration) {
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			s.reload("SIGHUP")
+		case <-ticker.C:
+			if s.config.Changed() {
+				s.reload("a change of the configuration files")
+			}
+		}
+	}
+}
+
+// reload reloads the configuration. The configuration in force is kept when the new one fails.
+func (s *server) reload(reason string) {
+
+	err := s.config.Reload()
+	if err != nil {
+		s.logger.Error("[Config]: fail to reload the configuration. the configuration in force is kept", "reason", reason, logging.FieldError, err)
+		return
+	}
+
+	s.logger.Info("[Config]: configuration reloaded", "reason", reason)
+}
+
+// newApplication builds the web application with the configuration, cfg, on the stores, logging with the logger.
+// The mailer and the ephemeral signing keys of the previous web application, prev (if any), are carried over when they are unchanged,
+// so a reload does not invalidate the ID tokens and pickup codes issued with an ephemeral key.
+func newApplication(cfg *config.Config, st *stores, prev *application, logger *slog.Logger) (*application, error) {
+
+	// instantiate the mailer used to deliver the password reset links.
+	var m mailer.Mailer
+	if prev != nil && prev.config.Mailer == cfg.Mailer {
+		m = prev.mailer
+	} else {
+		var err error
+		m, err = mailer.New(
+			cfg.Mailer.Kind,
+			cfg.Mailer.From,
+			cfg.Mailer.SMTPHost,
+			cfg.Mailer.SMTPPort,
+			cfg.Mailer.SMTPUsername,
+			cfg.Mailer.SMTPPassword,
+			cfg.Mailer.File,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// load the key used to sign the OpenID Connect ID tokens.
+	// an ephemeral key is generated when no key file is set, i.e. in development.
+	var signingKey *rsa.PrivateKey
+	if keyFile := cfg.OIDCSigningKeyFile; keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		signingKey, err = jwt.ParseRSAPrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+	} else if prev != nil && prev.config.OIDCSigningKeyFile == "" {
+		signingKey = prev.oauth.SigningKey
+	} else {
+		logger.Info("[OIDC]: OIDC_SIGNING_KEY_FILE is not set. using an ephemeral signing key")
+		var err error
+		signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// load the key used to sign the pickup codes, which the lockers verify offline.
+	// an ephemeral key is generated when no key file is set, i.e. in development.
+	var pickupKey ed25519.PrivateKey
+	if keyFile := cfg.PickupSigningKeyFile; keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		pickupKey, err = pickup.ParsePrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+	} else if prev != nil && prev.config.PickupSigningKeyFile == "" {
+		pickupKey = prev.pickups.Key
+	} else {
+		logger.Info("[Pickup]: PICKUP_SIGNING_KEY_FILE is not set. using an ephemeral signing key")
+		var err error
+		_, pickupKey, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// load the rules of the requests forwarded by the reverse proxies.
+	var forwardRules authz.Rules
+	if rulesFile := cfg.ForwardAuthRulesFile; rulesFile != "" {
+		b, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		forwardRules, err = authz.ParseRules(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// declare and instantiate a web application
+	app := &application{
+		logger:        logger,
+		dataStore:     ds,
+		config:        cfg,
+		roles:         st.roles,
+		orgs:          st.orgs,
+		mailer:        m,
+		tokens:        st.tokens,
+		resetTokenTTL: cfg.ResetTokenTTL,
+		resetURL:      cfg.PasswordResetURL,
+		registration: &users.Registration{
+			DataStore: ds,
+			Tokens:    st.tokens,
+			Mailer:    m,
+			VerifyURL: cfg.SignupVerifyURL,
+			TokenTTL:  cfg.VerifyTokenTTL,
+		},
+		oauth: &oauth.Server{
+			DataStore: ds,
+			Clients:   st.clients,
+			Codes:     st.codes,
+			Roles:     st.roles,
+			Orgs:      st.orgs,
+			Issuer:    cfg.JWTIssuer,
+			SecretKey: cfg.JWTSecretKey,
+			TokenTTL:  cfg.JWTExp,
+			CodeTTL:   time.Minute,
+
+			IssuerURL:  cfg.OIDCIssuerURL,
+			SigningKey: signingKey,
+
+			Devices:            st.devices,
+			DeviceCodeTTL:      10 * time.Minute,
+			DevicePollInterval: 5 * time.Second,
+		},
+		apiKeys: &users.APIKeys{
+			DataStore: ds,
+			Keys:      st.apiKeys,
+		},
+		impersonation: &users.Impersonation{
+			DataStore: ds,
+			Sessions:  st.impersonations,
+			Roles:     st.roles,
+			Orgs:      st.orgs,
+			Issuer:    cfg.JWTIssuer,
+			SecretKey: cfg.JWTSecretKey,
+			TTL:       cfg.ImpersonationTTL,
+		},
+		adminRoles: &users.Roles{
+			DataStore: ds,
+			Store:     st.roles,
+			Orgs:      st.orgs,
+		},
+		organizations: &users.Organizations{
+			DataStore: ds,
+			Orgs:      st.orgs,
+			Roles:     st.roles,
+		},
+		delegations: &users.Delegations{
+			DataStore:   ds,
+			Grants:      st.delegations,
+			Roles:       st.roles,
+			Orgs:        st.orgs,
+			Issuer:      cfg.JWTIssuer,
+			SecretKey:   cfg.JWTSecretKey,
+			TokenTTL:    cfg.DelegationTokenTTL,
+			MaxValidity: cfg.DelegationMaxValidity,
+		},
+		sessions: &users.Sessions{
+			DataStore: ds,
+			Store:     st.sessions,
+			Cookies: middlewares.CookieOptions{
+				Domain:   cfg.CookieDomain,
+				SameSite: cfg.CookieSameSite,
+			},
+		},
+		pickups: pickup.Issuer{
+			Key: pickupKey,
+			TTL: cfg.PickupCodeTTL,
+		},
+		forward: &authz.Forward{
+			Rules: forwardRules,
+		},
+	}
+	// the introspection endpoint honours the revocations of the Authenticate middleware.
+	app.oauth.Revokers = []middlewares.Revoker{app.impersonation, app.delegations, app.sessions}
+	mux := app.routes()
+	app.handler = middlewares.RequestID(logger, mux, middlewares.Trace(mux, metrics.Instrument(mux)))
+
+	return app, nil
+}
+
+// storeStats returns the statistics of the stores, by store, for the gauges of '/metrics'.
+func (s *server) storeStats() map[string]data.Stats {
+	return map[string]data.Stats{
+		"users":             ds.Stats(),
+		"sessions":          s.stores.sessions.Stats(),
+		"api_keys":          s.stores.apiKeys.Stats(),
+		"delegations":       s.stores.delegations.Stats(),
+		"impersonations":    s.stores.impersonations.Stats(),
+		"single_use_tokens": s.stores.tokens.Stats(),
+	}
+}
+
+// registerStoreMetrics registers the gauges of the sizes and the avl tree heights of the stores, read on every scrape.
+func (s *server) registerStoreMetrics() {
+
+	metrics.Default.NewGaugeFunc("passer_store_size", "Number of records in the in-memory stores, by store.", "store",
+		func() map[string]float64 {
+			values := map[string]float64{}
+			for name, st := range s.storeStats() {
+				values[name] = float64(st.Size)
+			}
+			return values
+		})
+
+	metrics.Default.NewGaugeFunc("passer_store_avl_height", "Height of the avl trees of the in-memory stores, by store.", "store",
+		func() map[string]float64 {
+			values := map[string]float64{}
+			for name, st := range s.storeStats() {
+				values[name] = float64(st.Height)
+			}
+			return values
+		})
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the name of the service, the 'service.name' of the resource of the spans.
+const ServiceName = "passer-auth-service"
+
+// instrumentationName is the name of the tracer of the spans, i.e. of the instrumented module.
+const instrumentationName = "github.com/go-qiu/passer-auth-service"
+
+// Exporter exports the ended spans, in batches (an exporter of the OpenTelemetry SDK).
+type Exporter = sdktrace.SpanExporter
+
+// NopExporter drops the spans. It is the default exporter.
+type NopExporter struct{}
+
+// ExportSpans drops the spans.
+func (NopExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error { return nil }
+
+// Shutdown does nothing.
+func (NopExporter) Shutdown(ctx context.Context) error { return nil }
+
+// NewStdoutExporter returns an exporter writing the spans to w, one JSON object per line, e.g. to the standard output, for local debugging.
+func NewStdoutExporter(w io.Writer) (Exporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// NewOTLPExporter returns an exporter sending the spans to the OpenTelemetry collector at endpoint, over OTLP/HTTP in protobuf,
+// e.g. 'http://localhost:4318/v1/traces'. The collector is only reached on the first export, so it may be down at startup.
+func NewOTLPExporter(endpoint string) (Exporter, error) {
+	return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+}
+
+// the tracer provider in force, with the exporter set last.
+var (
+	providerMu sync.RWMutex
+	provider   = newProvider(NopExporter{})
+)
+
+// newProvider returns a tracer provider exporting the spans with e. A nil exporter, or NopExporter, drops them.
+func newProvider(e Exporter) *sdktrace.TracerProvider {
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	}
+	if _, nop := e.(NopExporter); e != nil && !nop {
+		opts = append(opts, sdktrace.WithBatcher(e))
+	}
+
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// SetExporter sets the exporter of the spans started from now on. A nil exporter drops them.
+// The previous exporter is shut down in the background, once it has exported the spans it holds.
+func SetExporter(e Exporter) {
+
+	p := newProvider(e)
+
+	providerMu.Lock()
+	prev := provider
+	provider = p
+	providerMu.Unlock()
+
+	go prev.Shutdown(context.Background())
+}
+
+// Shutdown exports the spans held by the exporter in force, and shuts it down, e.g. before the service exits.
+// The spans started afterwards are dropped.
+func Shutdown(ctx context.Context) error {
+
+	providerMu.RLock()
+	p := provider
+	providerMu.RUnlock()
+
+	return p.Shutdown(ctx)
+}
+
+func tracer() trace.Tracer {
+
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+
+	return provider.Tracer(instrumentationName)
+}
@@ -0,0 +1,189 @@
+/*
+Package tracing records the spans of the requests served by the service, i.e. the timed operations of a trace,
+with the OpenTelemetry SDK (https://opentelemetry.io/docs/languages/go/), behind a facade of its own.
+
+The trace of a request continues the trace of the caller, from its W3C 'traceparent' header (see ParseTraceParent).
+The spans are handed to the exporter in force (see SetExporter) once ended: the default exporter drops them,
+the stdout exporter writes them as JSON, e.g. for local debugging, and the OTLP exporter sends them, in batches,
+to an OpenTelemetry collector over OTLP/HTTP (see NewOTLPExporter).
+*/
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceParentHeader is the header of the W3C trace context (https://www.w3.org/TR/trace-context/).
+const TraceParentHeader = "traceparent"
+
+// TraceID is the id of a trace.
+type TraceID [16]byte
+
+// SpanID is the id of a span.
+type SpanID [8]byte
+
+// String returns the id, hex encoded.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// String returns the id, hex encoded.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext identifies a span, and tells if its trace is sampled (i.e. exported).
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid checks if the span context has a trace id and a span id.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// TraceParent returns the span context in the format of the 'traceparent' header.
+func (sc SpanContext) TraceParent() string {
+
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// otel returns the span context, as a remote span context of the OpenTelemetry API.
+func (sc SpanContext) otel() trace.SpanContext {
+
+	var flags trace.TraceFlags
+	if sc.Sampled {
+		flags = trace.FlagsSampled
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID(sc.TraceID),
+		SpanID:     trace.SpanID(sc.SpanID),
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
+
+// fromOTel returns the span context of the OpenTelemetry API, sc, as a SpanContext.
+func fromOTel(sc trace.SpanContext) SpanContext {
+	return SpanContext{TraceID: TraceID(sc.TraceID()), SpanID: SpanID(sc.SpanID()), Sampled: sc.IsSampled()}
+}
+
+// ParseTraceParent parses the value of a 'traceparent' header (version 00, or a later version, as its first four fields),
+// with the W3C trace context propagator of OpenTelemetry.
+func ParseTraceParent(v string) (SpanContext, bool) {
+
+	carrier := propagation.MapCarrier{TraceParentHeader: v}
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	return fromOTel(sc), true
+}
+
+// Span is a timed operation of a trace. Its methods are safe to call on a nil span, which records nothing.
+type Span struct {
+	span trace.Span
+}
+
+// SpanContext returns the span context of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return fromOTel(s.span.SpanContext())
+}
+
+// SetAttribute sets the attribute of the span. The value is a string, a bool, an int, an int64 or a float64,
+// or else it is set as its string format.
+func (s *Span) SetAttribute(key string, value interface{}) {
+
+	if s == nil {
+		return
+	}
+
+	s.span.SetAttributes(keyValue(key, value))
+}
+
+// keyValue returns the attribute of the span, key and value, as an attribute of the OpenTelemetry API.
+func keyValue(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
+
+// SetError marks the span as failed with the error, if not nil.
+func (s *Span) SetError(err error) {
+
+	if s == nil || err == nil {
+		return
+	}
+
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span, and exports it when its trace is sampled. Only the first call ends it.
+func (s *Span) End() {
+
+	if s == nil {
+		return
+	}
+
+	s.span.End()
+}
+
+// ContextWithRemote returns a copy of ctx carrying the span context of the caller, sc, the parent of the next span started.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return trace.ContextWithRemoteSpanContext(ctx, sc.otel())
+}
+
+// SpanFromContext returns the span of ctx, if any.
+func SpanFromContext(ctx context.Context) *Span {
+
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() || span.SpanContext().IsRemote() {
+		return nil
+	}
+
+	return &Span{span: span}
+}
+
+// Start starts a span, named name, child of the span of ctx, or else of the span of the caller (see ContextWithRemote),
+// or else the first span of a new trace. It returns a copy of ctx carrying the span. The span must be ended.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindInternal)
+}
+
+// StartServer starts the span of a request served, like Start.
+func StartServer(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindServer)
+}
+
+func start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, *Span) {
+
+	ctx, span := tracer().Start(ctx, name, trace.WithSpanKind(kind))
+
+	return ctx, &Span{span: span}
+}
@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestParseTraceParent checks the 'traceparent' headers accepted and rejected.
+func TestParseTraceParent(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		value       string
+		ok          bool
+		wantSampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ok: true, wantSampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ok: true},
+		{name: "later version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ok: true, wantSampled: true},
+		{name: "empty", value: ""},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "version 00 with extra fields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "upper case", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{name: "short trace id", value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			sc, ok := ParseTraceParent(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("want ok %v, got %v", tt.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("ids: %s, %s", sc.TraceID, sc.SpanID)
+			}
+			if sc.Sampled != tt.wantSampled {
+				t.Errorf("sampled: want %v, got %v", tt.wantSampled, sc.Sampled)
+			}
+		})
+	}
+}
+
+// TestStart checks that the spans continue the trace of the caller, nest, and are exported with their attributes and status.
+func TestStart(t *testing.T) {
+
+	exp := tracetest.NewInMemoryExporter()
+	SetExporter(exp)
+	defer SetExporter(nil)
+
+	remote, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := StartServer(ContextWithRemote(context.Background(), remote), "GET /users")
+	if got := SpanFromContext(ctx); got == nil || got.SpanContext() != server.SpanContext() {
+		t.Fatal("the span of the context is not the server span")
+	}
+	_, child := Start(ctx, "DataStore.Find")
+	child.SetAttribute("store.found", false)
+	child.SetError(errors.New("not found"))
+	child.End()
+	server.SetAttribute("http.status_code", 200)
+	server.End()
+	server.End()
+
+	// the in-memory exporter forgets the spans on shutdown, so they are flushed only.
+	err := provider.ForceFlush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+	c, s := spans[0], spans[1]
+	if s.Name != "GET /users" || s.SpanKind != trace.SpanKindServer || c.SpanKind != trace.SpanKindInternal {
+		t.Errorf("spans: %s (%v), %s (%v)", s.Name, s.SpanKind, c.Name, c.SpanKind)
+	}
+	if s.SpanContext.TraceID().String() != remote.TraceID.String() || s.Parent.SpanID().String() != remote.SpanID.String() {
+		t.Errorf("the server span does not continue the trace of the caller: %s, parent %s", s.SpanContext.TraceID(), s.Parent.SpanID())
+	}
+	if c.Parent.SpanID() != s.SpanContext.SpanID() {
+		t.Errorf("the child span is not a child of the server span")
+	}
+	if c.Status.Code != codes.Error || c.Status.Description != "not found" {
+		t.Errorf("status: %v", c.Status)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Value.AsInt64() != 200 {
+		t.Errorf("attributes: %v", s.Attributes)
+	}
+}
+
+// TestSpanFromContext checks that a context without a span of the service, e.g. with the span of the caller only, has none.
+func TestSpanFromContext(t *testing.T) {
+
+	if SpanFromContext(context.Background()) != nil {
+		t.Error("an empty context has a span")
+	}
+
+	remote, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if SpanFromContext(ContextWithRemote(context.Background(), remote)) != nil {
+		t.Error("the span of the caller is taken for a span of the service")
+	}
+
+	// the methods of a nil span record nothing.
+	var s *Span
+	s.SetAttribute("k", "v")
+	s.SetError(errors.New("e"))
+	s.End()
+}
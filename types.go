@@ -1,9 +1,17 @@
 package main
 
 import (
-	"log"
+	"log/slog"
+	"net/http"
+	"time"
 
+	"github.com/go-qiu/passer-auth-service/authz"
+	"github.com/go-qiu/passer-auth-service/config"
 	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/mailer"
+	"github.com/go-qiu/passer-auth-service/oauth"
+	"github.com/go-qiu/passer-auth-service/pickup"
+	"github.com/go-qiu/passer-auth-service/users"
 )
 
 // JWTPayload struct is for holding the data used in generating the second segment (i.e. payload) of the JWT string.
@@ -24,7 +32,54 @@ type JWTHeader struct {
 
 // application struct is for facilitating the implementation of the dependencies injection model.
 type application struct {
-	errorLog  *log.Logger
-	infoLog   *log.Logger
+	logger    *slog.Logger
 	dataStore *data.DataStore
+
+	// settings the web application was built with (see newApplication)
+	config *config.Config
+
+	// routes of the web application
+	handler http.Handler
+
+	// roles, i.e. the permission sets assigned to the users.
+	roles *data.RoleStore
+
+	// organizations, i.e. the merchants owning the accounts of their staff and agents.
+	orgs *data.OrganizationStore
+
+	// password reset
+	mailer        mailer.Mailer
+	tokens        *data.TokenStore
+	resetTokenTTL time.Duration
+	resetURL      string
+
+	// self-registration
+	registration *users.Registration
+
+	// OAuth 2.0 authorization server
+	oauth *oauth.Server
+
+	// API keys
+	apiKeys *users.APIKeys
+
+	// admin impersonation
+	impersonation *users.Impersonation
+
+	// role management
+	adminRoles *users.Roles
+
+	// organization management
+	organizations *users.Organizations
+
+	// consumer-to-agent delegation
+	delegations *users.Delegations
+
+	// sessions of the tokens issued by '/auth'
+	sessions *users.Sessions
+
+	// one-time pickup codes of the locker stations
+	pickups pickup.Issuer
+
+	// forward-auth of the reverse proxies
+	forward *authz.Forward
 }
@@ -0,0 +1,200 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// apiKeyScopes are the scopes an API key can be restricted to.
+var apiKeyScopes = []string{"users:read", "users:write", "parcels:collect"}
+
+// paramsCreateAPIKey struct is for holding the 'POST /users/me/api-keys' request body content.
+type paramsCreateAPIKey struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+	AllowedIPs    []string `json:"allowedIps"`
+}
+
+// createdAPIKey is the response of a created API key; the only time the key itself is sent.
+type createdAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeys holds the dependencies of the '/users/me/api-keys' endpoints.
+type APIKeys struct {
+	DataStore *data.DataStore
+	Keys      *data.APIKeyStore
+}
+
+// Handler handles the requests on the API keys of the authenticated user. It is used with the Authenticate middleware.
+// - 'GET /users/me/api-keys' lists the keys;
+// - 'POST /users/me/api-keys' creates a key;
+// - 'DELETE /users/me/api-keys/{id}' revokes a key.
+// The keys can only be managed with the user's own JWT (see '/auth'), not with another API key, a token issued to an OAuth 2.0 client
+// (including a client acting on its own behalf) or a delegated token, so a key never holds more than the user's own session.
+func (ak *APIKeys) Handler(w http.ResponseWriter, r *http.Request) {
+
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || pl.ClientId != "" {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[API-Keys]: api keys can only be managed with the user's own token", nil)
+		return
+	}
+	if pl.Act != nil {
+		// an impersonating admin (or a delegated party) must not leave a credential behind.
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[API-Keys]: api keys cannot be managed with a delegated token", nil)
+		return
+	}
+	userId := pl.Subject()
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/me/api-keys"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		helpers.WriteJSON(w, http.StatusOK, true, "[API-Keys]: api keys of the user", ak.Keys.ListByUser(userId))
+	case r.Method == http.MethodPost && id == "":
+		ak.create(w, r, pl)
+	case r.Method == http.MethodDelete && id != "":
+		err := ak.Keys.Remove(id, userId)
+		if err != nil {
+			middlewares.Audit(r, audit.ActionAPIKeyRevoke, id, audit.OutcomeFailure)
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		middlewares.Audit(r, audit.ActionAPIKeyRevoke, id, audit.OutcomeSuccess)
+		helpers.WriteJSON(w, http.StatusOK, true, "[API-Keys]: api key revoked", nil)
+	default:
+		msg := fmt.Sprintf("[API-Keys]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// create handles the request to create an API key for the user of the payload, pl.
+// A key can only be restricted to the scopes of the permissions the user holds.
+func (ak *APIKeys) create(w http.ResponseWriter, r *http.Request, pl jwt.JWTPayload) {
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		helpers.WriteJSON(w, http.StatusUnsupportedMediaType, false, "[API-Keys]: request body must be json", nil)
+		return
+	}
+
+	var params paramsCreateAPIKey
+	err := json.Unmarshal(getBody(&w, r), &params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[API-Keys]: request body is not a valid json", nil)
+		return
+	}
+
+	// exceptions handling
+	if isEmptyString(params.Name) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name is a required attribute", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "scopes is a required attribute and must not be empty", nil)
+		return
+	}
+	for _, s := range params.Scopes {
+		if !contains(apiKeyScopes, s) {
+			msg := fmt.Sprintf("scopes must only contain %s", strings.Join(apiKeyScopes, ", "))
+			helpers.WriteJSON(w, http.StatusBadRequest, false, msg, nil)
+			return
+		}
+		if !pl.HasPermission(s) {
+			msg := fmt.Sprintf("[API-Keys]: not allowed to create an api key with the scope, '%s'", s)
+			helpers.WriteJSON(w, http.StatusForbidden, false, msg, nil)
+			return
+		}
+	}
+	if params.ExpiresInDays < 0 {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "expiresInDays must not be negative", nil)
+		return
+	}
+	for _, ip := range params.AllowedIPs {
+		_, _, cidrErr := net.ParseCIDR(ip)
+		if net.ParseIP(ip) == nil && cidrErr != nil {
+			msg := fmt.Sprintf("allowedIps contains an invalid ip address or CIDR block, '%s'", ip)
+			helpers.WriteJSON(w, http.StatusBadRequest, false, msg, nil)
+			return
+		}
+	}
+
+	// ok. ready.
+	k, key, err := newAPIKey(pl.Subject(), params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[API-Keys]: fail to create api key", nil)
+		return
+	}
+
+	err = ak.Keys.Insert(k)
+	if err != nil {
+		middlewares.Audit(r, audit.ActionAPIKeyCreate, k.Id, audit.OutcomeFailure)
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[API-Keys]: fail to create api key", nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionAPIKeyCreate, k.Id, audit.OutcomeSuccess)
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.WriteJSON(w, http.StatusCreated, true, "[API-Keys]: api key created. it will not be shown again", createdAPIKey{APIKey: k, Key: key})
+}
+
+// newAPIKey generates an API key, psr_<id>_<secret>, and its record (with the hash of the key).
+func newAPIKey(userId string, params paramsCreateAPIKey) (models.APIKey, string, error) {
+
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	id := hex.EncodeToString(b)
+
+	secret, err := helpers.NewRandomToken(32)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	key := fmt.Sprintf("%s%s_%s", models.APIKeyPrefix, id, secret)
+	now := time.Now()
+
+	k := models.APIKey{
+		Id:         id,
+		Name:       strings.TrimSpace(params.Name),
+		Hash:       helpers.HashToken(key),
+		UserId:     userId,
+		Scopes:     params.Scopes,
+		AllowedIPs: params.AllowedIPs,
+		CreatedAt:  now,
+	}
+	if k.AllowedIPs == nil {
+		k.AllowedIPs = []string{}
+	}
+	if params.ExpiresInDays > 0 {
+		k.ExpiresAt = now.AddDate(0, 0, params.ExpiresInDays)
+	}
+
+	return k, key, nil
+}
+
+// contains checks if the value is one of the elements of v.
+func contains(v []string, value string) bool {
+	for _, element := range v {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package users
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPwHash is compared against when the email is not registered, so that
+// an unknown email costs the same bcrypt work as a registered one.
+var dummyPwHash []byte
+
+func init() {
+	var err error
+	dummyPwHash, err = bcrypt.GenerateFromPassword([]byte("passer.dummy.password"), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// CheckCredentials returns the user registered with email when pw matches the password hash of an active user.
+// The same bcrypt comparison is executed whether or not the email is registered,
+// so the response time does not reveal the registered emails.
+// The lookup and the comparison (with its bcrypt cost) are recorded as spans of the trace of ctx.
+func CheckCredentials(ctx context.Context, ds *data.DataStore, email string, pw string) (models.User, error) {
+
+	pwHash := dummyPwHash
+	var user models.User
+	found, err := ds.FindContext(ctx, email)
+	if err == nil {
+		// found.
+		user = found.GetItem().(models.User)
+		pwHash = []byte(user.PwHash)
+	}
+
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
+	if cost, err := bcrypt.Cost(pwHash); err == nil {
+		span.SetAttribute("bcrypt.cost", cost)
+	}
+	start := time.Now()
+	err = bcrypt.CompareHashAndPassword(pwHash, []byte(pw))
+	metrics.BcryptDuration.ObserveSince(start, "compare")
+	span.End()
+	if err != nil || found == nil {
+		// pwhash does not match or the email is not registered.
+		return models.User{}, ErrAuthFail
+	}
+
+	if !user.IsActive {
+		// pending (i.e. email not verified yet) or deactivated account.
+		return models.User{}, ErrAuthFail
+	}
+
+	return user, nil
+}
@@ -0,0 +1,281 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// DelegationClientId is the 'client_id' of the delegated tokens, so they are restricted by their scopes (see middlewares.RequireScope).
+const DelegationClientId = "delegation"
+
+// delegationScopes are the scopes a consumer can delegate to an agent.
+var delegationScopes = []string{models.PermParcelsCollect}
+
+// paramsCreateDelegation struct is for holding the 'POST /users/me/delegations' request body content.
+type paramsCreateDelegation struct {
+	AgentEmail string    `json:"agentEmail"`
+	Scopes     []string  `json:"scopes"`
+	NotBefore  time.Time `json:"notBefore"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// delegationList is the response of 'GET /users/me/delegations'.
+type delegationList struct {
+	Granted  []models.Delegation `json:"granted"`
+	Received []models.Delegation `json:"received"`
+}
+
+// delegatedToken is the response of a delegated token minted for an agent.
+type delegatedToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Delegations holds the dependencies of the '/users/me/delegations' endpoints.
+type Delegations struct {
+	DataStore *data.DataStore
+	Grants    *data.DelegationStore
+	Roles     *data.RoleStore
+	Orgs      *data.OrganizationStore
+
+	// attributes of the delegated tokens issued.
+	Issuer    string
+	SecretKey string
+	TokenTTL  time.Duration
+
+	// the longest validity window of a grant.
+	MaxValidity time.Duration
+}
+
+// Handler handles the requests on the delegation grants of the authenticated user. It is used with the Authenticate middleware.
+// - 'GET /users/me/delegations' lists the grants given (as a consumer) and received (as an agent);
+// - 'POST /users/me/delegations' grants an agent the scopes on the consumer's behalf;
+// - 'DELETE /users/me/delegations/{id}' revokes a grant, by either party, and the delegated tokens minted from it;
+// - 'POST /users/me/delegations/{id}/token' mints a delegated token for the agent of the grant.
+// The grants can only be managed with the user's own JWT (see '/auth'), not with an API key, a token issued to an OAuth 2.0 client or a delegated token.
+func (dg *Delegations) Handler(w http.ResponseWriter, r *http.Request) {
+
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || pl.ClientId != "" || pl.Act != nil {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Delegations]: delegations can only be managed with the user's own token", nil)
+		return
+	}
+	userId := pl.Subject()
+
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/me/delegations"), "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		list := delegationList{Granted: dg.Grants.ListByConsumer(userId), Received: dg.Grants.ListByAgent(userId)}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Delegations]: delegations of the user", list)
+	case r.Method == http.MethodPost && id == "":
+		dg.create(w, r, pl)
+	case r.Method == http.MethodDelete && id != "" && action == "":
+		d, err := dg.Grants.Revoke(id, userId, time.Now())
+		if err != nil {
+			middlewares.Audit(r, audit.ActionDelegationRevoke, id, audit.OutcomeFailure)
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		middlewares.Audit(r, audit.ActionDelegationRevoke, d.AgentId, audit.OutcomeSuccess)
+		helpers.WriteJSON(w, http.StatusOK, true, "[Delegations]: delegation revoked", d)
+	case r.Method == http.MethodPost && id != "" && action == "token":
+		dg.mint(w, r, id, userId)
+	default:
+		msg := fmt.Sprintf("[Delegations]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// IsRevoked checks if the payload is of a delegated token whose grant has been revoked or has come to pass.
+func (dg *Delegations) IsRevoked(pl jwt.JWTPayload) bool {
+
+	if pl.ClientId != DelegationClientId || pl.Jti == "" {
+		return false
+	}
+
+	d, err := dg.Grants.Find(pl.Jti)
+	if err != nil {
+		// a delegated token always has a grant.
+		return true
+	}
+
+	return !d.IsValid(time.Now())
+}
+
+// SweepInactive removes the grants that have been revoked or have expired, every interval.
+// It runs until the program exits.
+func (dg *Delegations) SweepInactive(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		dg.Grants.RemoveInactive(now)
+	}
+}
+
+// create handles the request of the consumer to grant an agent the scopes.
+func (dg *Delegations) create(w http.ResponseWriter, r *http.Request, pl jwt.JWTPayload) {
+
+	// only a consumer, i.e. a user receiving parcels, can delegate their collection.
+	if !pl.HasPermission(models.PermParcelsRead) {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Delegations]: only a consumer can delegate", nil)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		helpers.WriteJSON(w, http.StatusUnsupportedMediaType, false, "[Delegations]: request body must be json", nil)
+		return
+	}
+
+	var params paramsCreateDelegation
+	err := json.Unmarshal(getBody(&w, r), &params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Delegations]: request body is not a valid json", nil)
+		return
+	}
+
+	// exceptions handling
+	now := time.Now()
+	params.AgentEmail = strings.ToLower(strings.TrimSpace(params.AgentEmail))
+	if isEmptyString(params.AgentEmail) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "agentEmail is a required attribute", nil)
+		return
+	}
+	if params.AgentEmail == pl.Subject() {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Delegations]: a user cannot delegate to themselves", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		params.Scopes = delegationScopes
+	}
+	for _, s := range params.Scopes {
+		if !contains(delegationScopes, s) {
+			msg := fmt.Sprintf("scopes must only contain %s", strings.Join(delegationScopes, ", "))
+			helpers.WriteJSON(w, http.StatusBadRequest, false, msg, nil)
+			return
+		}
+	}
+	if params.NotBefore.IsZero() {
+		params.NotBefore = now
+	}
+	if params.ExpiresAt.IsZero() {
+		params.ExpiresAt = params.NotBefore.Add(dg.MaxValidity)
+	}
+	if !params.ExpiresAt.After(params.NotBefore) || !params.ExpiresAt.After(now) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "expiresAt must be after notBefore and in the future", nil)
+		return
+	}
+	if params.ExpiresAt.Sub(params.NotBefore) > dg.MaxValidity {
+		msg := fmt.Sprintf("[Delegations]: a delegation must not be valid for longer than %s", dg.MaxValidity)
+		helpers.WriteJSON(w, http.StatusBadRequest, false, msg, nil)
+		return
+	}
+
+	// the agent must be an active user who can collect parcels.
+	found, err := dg.DataStore.FindContext(r.Context(), params.AgentEmail)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Delegations]: agent not found", nil)
+		return
+	}
+	agent := found.GetItem().(models.User)
+	_, perms := data.ClaimsOf(agent, dg.Roles, dg.Orgs)
+	if !agent.IsActive || !contains(perms, models.PermParcelsCollect) {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Delegations]: agent not found", nil)
+		return
+	}
+
+	// ok. ready.
+	id, err := helpers.NewRandomToken(16)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Delegations]: fail to delegate", nil)
+		return
+	}
+
+	d := models.Delegation{
+		Id:         id,
+		ConsumerId: pl.Subject(),
+		AgentId:    agent.Id,
+		Scopes:     params.Scopes,
+		NotBefore:  params.NotBefore,
+		ExpiresAt:  params.ExpiresAt,
+		CreatedAt:  now,
+	}
+
+	err = dg.Grants.Insert(d)
+	if err != nil {
+		middlewares.Audit(r, audit.ActionDelegationCreate, d.AgentId, audit.OutcomeFailure)
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Delegations]: fail to delegate", nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionDelegationCreate, d.AgentId, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Delegations]: delegation granted", d)
+}
+
+// mint handles the request of the agent to mint a delegated token from the grant with the id.
+// The token is issued to the consumer ('sub'), with the agent as the actor ('act'), restricted to the scopes of the grant.
+// It never outlives the grant, and is revoked with it (see IsRevoked).
+func (dg *Delegations) mint(w http.ResponseWriter, r *http.Request, id string, agentId string) {
+
+	now := time.Now()
+
+	d, err := dg.Grants.Find(id)
+	if err != nil || d.AgentId != agentId {
+		helpers.WriteJSON(w, http.StatusNotFound, false, data.ErrDelegationNotFound.Error(), nil)
+		return
+	}
+	if !d.IsValid(now) {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Delegations]: delegation is not in force", nil)
+		return
+	}
+
+	found, err := dg.DataStore.FindContext(r.Context(), d.ConsumerId)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Delegations]: consumer not found", nil)
+		return
+	}
+	consumer := found.GetItem().(models.User)
+	if !consumer.IsActive {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Delegations]: consumer is not active", nil)
+		return
+	}
+
+	exp := now.Add(dg.TokenTTL)
+	if d.ExpiresAt.Before(exp) {
+		exp = d.ExpiresAt
+	}
+
+	token, err := jwt.Sign(jwt.JWTPayload{
+		Id:       consumer.Email,
+		Name:     strings.TrimSpace(consumer.Name.First + " " + consumer.Name.Last),
+		Roles:    []string{},
+		IsActive: consumer.IsActive,
+		Iss:      dg.Issuer,
+		Exp:      exp.UnixMilli(),
+		Perms:    d.Scopes,
+		Sub:      consumer.Id,
+		ClientId: DelegationClientId,
+		Scope:    strings.Join(d.Scopes, " "),
+		Act:      &jwt.Actor{Sub: d.AgentId},
+		Jti:      d.Id,
+	}, dg.SecretKey)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Delegations]: fail to mint delegated token", nil)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Delegations]: delegated token minted", delegatedToken{Token: token, ExpiresAt: exp})
+}
@@ -1,25 +1,15 @@
 package users
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/go-qiu/passer-auth-service/data"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/tracing"
 )
 
-var mapUsers = map[string]user{}
-
-type user struct {
-	Username string `json:"username"`
-	PwHash   string `json:"pwhash"`
-	First    string `json:"first"`
-	Last     string `json:"last"`
-}
-
 type name struct {
 	First string `json:"first"`
 	Last  string `json:"last"`
@@ -84,12 +74,40 @@ var (
 // 	}
 // }
 
+// operations are the operations on the users, by the method of the request.
+var operations = map[string]string{
+	http.MethodGet:    "read",
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodDelete: "delete",
+}
+
 // Handler handles all users data related data operations.
-func Handler(w http.ResponseWriter, r *http.Request, ds *data.DataStore) {
+// The roles assigned to the users must be defined in the role store.
+func Handler(w http.ResponseWriter, r *http.Request, ds *data.DataStore, roles *data.RoleStore) {
 
 	// set the response header, "Content-Type" to "application/json".
 	w.Header().Set("Content-Type", "application/json")
 
+	// trace the operation, with the store calls it makes as child spans.
+	ctx, span := tracing.Start(r.Context(), "users.Handler")
+	defer span.End()
+	span.SetAttribute("http.method", r.Method)
+	r = r.WithContext(ctx)
+
+	// count the operation, by its outcome.
+	if op, ok := operations[r.Method]; ok {
+		rec := &metrics.StatusRecorder{ResponseWriter: w}
+		w = rec
+		defer func() {
+			result := "success"
+			if rec.StatusCode() >= http.StatusBadRequest {
+				result = "failure"
+			}
+			metrics.UserOperations.Inc(op, result)
+		}()
+	}
+
 	if r.Method == http.MethodGet {
 		// 'GET' request
 		handleGetRequest(&w, r, ds)
@@ -108,11 +126,11 @@ func Handler(w http.ResponseWriter, r *http.Request, ds *data.DataStore) {
 			if r.Method == http.MethodPost {
 
 				// 'POST' request --> add
-				handlePostRequest(&w, r, ds, body)
+				handlePostRequest(&w, r, ds, roles, body)
 			} else if r.Method == http.MethodPut {
 
 				// 'PUT' request --> update
-				handlePutRequest(&w, r, ds, body)
+				handlePutRequest(&w, r, ds, roles, body)
 			} else if r.Method == http.MethodDelete {
 
 				// 'DELETE' request --> remove
@@ -127,65 +145,3 @@ func Handler(w http.ResponseWriter, r *http.Request, ds *data.DataStore) {
 	}
 
 }
-
-// Signup handles request to add a user. WIP.
-func SignUp(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		username := r.FormValue("usrename")
-		password := r.FormValue("password")
-		confirmation := r.FormValue("confirmation")
-		first := r.FormValue("first")
-		last := r.FormValue("last")
-
-		// exceptions handling
-		if isEmptyString(username) {
-			http.Error(w, "Username cannot be empty.", http.StatusForbidden)
-			return
-		}
-		if isEmptyString(password) {
-			http.Error(w, "Password cannot be empty.", http.StatusForbidden)
-			return
-		}
-		if isEmptyString(confirmation) {
-			http.Error(w, "Password cannot be empty.", http.StatusForbidden)
-			return
-		}
-		if confirmation == password {
-			http.Error(w, "2 password entries are not the same.", http.StatusForbidden)
-			return
-		}
-		if isEmptyString(first) {
-			http.Error(w, "First Name cannot be empty.", http.StatusForbidden)
-			return
-		}
-		if isEmptyString(last) {
-			http.Error(w, "Last Name cannot be empty.", http.StatusForbidden)
-			return
-		}
-		if _, ok := mapUsers[username]; ok {
-			http.Error(w, "Username is already taken.", http.StatusForbidden)
-			return
-		}
-
-		// ok. ready.
-		pwhash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
-		if err != nil {
-			http.Error(w, "Internal Server Error.", http.StatusInternalServerError)
-			return
-		}
-		newUser := user{Username: username, PwHash: string(pwhash), First: first, Last: last}
-		mapUsers[username] = newUser
-
-		// redirect to post sign-up page
-		// http.Redirect(w, r, "/", http.StatusSeeOther)
-		w.Header().Set("Content-Type", "application/json")
-		outcome, err := json.Marshal(newUser)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-		fmt.Fprintln(w, outcome)
-		return
-	}
-	// tpl.ExecuteTemplate(w, "signup.html", user{})
-}
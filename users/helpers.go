@@ -3,6 +3,9 @@ package users
 import (
 	"regexp"
 	"strings"
+
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/jwt"
 )
 
 // Function to check if the input, v is an empty string.
@@ -18,41 +21,50 @@ func isValidEmailFormat(v string) bool {
 	return pattern.MatchString(v)
 }
 
-// Function to check if the input, v is a nil slice of strings.
-// Return true when nil; false when not nil.
-func isEmptyStringSlice(v []string) bool {
-
-	if v == nil {
-		// nil. empty.
-		return true
-	}
+// Function to check if the input, v is in a valid email format, for the accounts of the self-registration and of the organization members.
+// It accepts the common forms of email (e.g. 'jane@gmail.com')
+// that isValidEmailFormat, which checks the accounts added through '/users', rejects.
+// Return true if valid; false if not valid.
+func isValidRegistrationEmail(v string) bool {
+	pattern := regexp.MustCompile(`^[a-z0-9_%+-]+([.-][a-z0-9_%+-]+)*@[a-z0-9-]+(\.[a-z0-9-]+)*\.[a-z]{2,}$`)
+	return pattern.MatchString(v)
+}
 
-	// not nil.  there are some strings in the slice.
-	return true
+// Function to check if the input, v is a nil or empty slice of strings.
+// Return true when nil or empty; false when there are some strings in the slice.
+func isEmptyStringSlice(v []string) bool {
+	return len(v) == 0
 }
 
 // Function to check if the input, v is a slice of strings
-// that are valid role values.
-// Valid values are "ADMIN", "AGENT", "USER"
-func areValidRoles(v []string) bool {
-
-	var status bool
+// that are all names of the roles defined in the role store.
+// Return true if all valid; false if any is not.
+func areValidRoles(v []string, roles *data.RoleStore) bool {
 
 	for _, element := range v {
 
 		if isEmptyString(element) {
 			// element is an empty string
-			break
+			return false
 		}
 
 		// ok. element is not empty.
+		_, err := roles.Find(element)
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
 
-		switch element {
-		case "ADMIN", "AGENT", "USER":
-			status = true
-		default:
-			status = false
+// Function to check if the caller, with the payload pl, holds all the permissions, perms,
+// so a caller can never grant (through a role) more than the caller has.
+// Return the first permission the caller does not hold, and false; or "" and true when all are held.
+func holdsAll(pl jwt.JWTPayload, perms []string) (string, bool) {
+	for _, perm := range perms {
+		if !pl.HasPermission(perm) {
+			return perm, false
 		}
 	}
-	return status
+	return "", true
 }
@@ -0,0 +1,199 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// paramsImpersonate struct is for holding the 'POST /admin/impersonations' request body content.
+type paramsImpersonate struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+// startedImpersonation is the response of a started impersonation session.
+type startedImpersonation struct {
+	models.Impersonation
+	Token string `json:"token"`
+}
+
+// Impersonation holds the dependencies of the '/admin/impersonations' endpoints.
+type Impersonation struct {
+	DataStore *data.DataStore
+	Sessions  *data.ImpersonationStore
+	Roles     *data.RoleStore
+	Orgs      *data.OrganizationStore
+
+	// attributes of the impersonation tokens issued.
+	Issuer    string
+	SecretKey string
+	TTL       time.Duration
+}
+
+// Handler handles the impersonation requests of the support staff, i.e. the users granted the 'users:impersonate' permission.
+// It is used with the Authenticate middleware.
+// - 'GET /admin/impersonations' lists the impersonation sessions that have not expired yet (the audit log keeps the trail of the others);
+// - 'POST /admin/impersonations' starts a session, i.e. issues a short-lived token for the target user;
+// - 'DELETE /admin/impersonations/{id}' ends a session, i.e. revokes its token.
+func (imp *Impersonation) Handler(w http.ResponseWriter, r *http.Request) {
+
+	// only a first-party token granted the permission, that is not itself impersonating, is allowed.
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || !pl.HasPermission(models.PermUsersImpersonate) || pl.Act != nil || pl.ClientId != "" {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Impersonation]: only the support staff can impersonate", nil)
+		return
+	}
+	adminId := pl.Subject()
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/impersonations"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		helpers.WriteJSON(w, http.StatusOK, true, "[Impersonation]: impersonation sessions", imp.Sessions.ListAll())
+	case r.Method == http.MethodPost && id == "":
+		imp.start(w, r, adminId)
+	case r.Method == http.MethodDelete && id != "":
+		i, err := imp.Sessions.End(id, time.Now())
+		if err != nil {
+			middlewares.Audit(r, audit.ActionImpersonationEnd, id, audit.OutcomeFailure)
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		middlewares.Audit(r, audit.ActionImpersonationEnd, i.UserId, audit.OutcomeSuccess)
+		helpers.WriteJSON(w, http.StatusOK, true, "[Impersonation]: impersonation session ended", i)
+	default:
+		msg := fmt.Sprintf("[Impersonation]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// IsRevoked checks if the payload is of an impersonation token whose session has ended.
+func (imp *Impersonation) IsRevoked(pl jwt.JWTPayload) bool {
+
+	if pl.Act == nil || pl.Jti == "" {
+		return false
+	}
+
+	i, err := imp.Sessions.Find(pl.Jti)
+	if err != nil {
+		// not an impersonation token.
+		return false
+	}
+
+	return i.HasEnded(time.Now())
+}
+
+// SweepExpired records the end of the sessions that expired without being ended in the audit log,
+// and removes the expired sessions, every interval. It runs until the program exits.
+func (imp *Impersonation) SweepExpired(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, i := range imp.Sessions.EndExpired(now) {
+			audit.Record(audit.Event{Actor: audit.ActorSystem, Action: audit.ActionImpersonationEnd, Target: i.UserId, Outcome: audit.OutcomeSuccess})
+		}
+		imp.Sessions.RemoveExpired(now)
+	}
+}
+
+// start handles the request of the admin to impersonate a user.
+func (imp *Impersonation) start(w http.ResponseWriter, r *http.Request, adminId string) {
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		helpers.WriteJSON(w, http.StatusUnsupportedMediaType, false, "[Impersonation]: request body must be json", nil)
+		return
+	}
+
+	var params paramsImpersonate
+	err := json.Unmarshal(getBody(&w, r), &params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Impersonation]: request body is not a valid json", nil)
+		return
+	}
+
+	if isEmptyString(params.Email) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "email is a required attribute", nil)
+		return
+	}
+	if isEmptyString(params.Reason) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "reason is a required attribute", nil)
+		return
+	}
+
+	found, err := imp.DataStore.FindContext(r.Context(), params.Email)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Impersonation]: user not found", nil)
+		return
+	}
+	user := found.GetItem().(models.User)
+
+	// the support staff cannot be impersonated, i.e. an impersonation cannot be chained.
+	org, perms := data.ClaimsOf(user, imp.Roles, imp.Orgs)
+	if contains(user.Roles, models.RoleAdmin) || contains(perms, models.PermUsersImpersonate) {
+		middlewares.Audit(r, audit.ActionImpersonationStart, user.Id, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Impersonation]: an ADMIN cannot be impersonated", nil)
+		return
+	}
+	if !user.IsActive {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Impersonation]: user is not active", nil)
+		return
+	}
+
+	// ok. ready.
+	id, err := helpers.NewRandomToken(16)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Impersonation]: fail to start impersonation", nil)
+		return
+	}
+
+	now := time.Now()
+	i := models.Impersonation{
+		Id:        id,
+		AdminId:   adminId,
+		UserId:    user.Id,
+		Reason:    strings.TrimSpace(params.Reason),
+		StartedAt: now,
+		ExpiresAt: now.Add(imp.TTL),
+	}
+
+	token, err := jwt.Sign(jwt.JWTPayload{
+		Id:       user.Email,
+		Name:     strings.TrimSpace(user.Name.First + " " + user.Name.Last),
+		Roles:    user.Roles,
+		IsActive: user.IsActive,
+		Iss:      imp.Issuer,
+		Exp:      i.ExpiresAt.UnixMilli(),
+		Perms:    perms,
+		Org:      org,
+		Sub:      user.Id,
+		Act:      &jwt.Actor{Sub: adminId},
+		Jti:      i.Id,
+	}, imp.SecretKey)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Impersonation]: fail to start impersonation", nil)
+		return
+	}
+
+	err = imp.Sessions.Insert(i)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Impersonation]: fail to start impersonation", nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionImpersonationStart, user.Id, audit.OutcomeSuccess)
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Impersonation]: impersonation session started", startedImpersonation{Impersonation: i, Token: token})
+}
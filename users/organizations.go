@@ -0,0 +1,440 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// orgIdPattern is the format of the organization ids, e.g. "bestbuy".
+var orgIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// paramsAddOrg struct is for holding the 'POST /admin/orgs' request body content.
+type paramsAddOrg struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Domain     string `json:"domain"`
+	OwnerEmail string `json:"ownerEmail"`
+}
+
+// paramsAddMember struct is for holding the 'POST /orgs/me/users' request body content.
+type paramsAddMember struct {
+	Email    string   `json:"email"`
+	Name     name     `json:"name"`
+	Password string   `json:"password"`
+	IsActive bool     `json:"isActive"`
+	Roles    []string `json:"roles"`
+}
+
+// paramsUpdateMember struct is for holding the 'PUT /orgs/me/users/{email}' request body content.
+type paramsUpdateMember struct {
+	Name     name     `json:"name"`
+	IsActive bool     `json:"isActive"`
+	Roles    []string `json:"roles"`
+}
+
+// orgView is an organization with its memberships.
+type orgView struct {
+	models.Organization
+	Members []models.Membership `json:"members"`
+}
+
+// memberView is a user account of an organization, with the user's roles within the organization.
+type memberView struct {
+	models.User
+	OrgRoles []string  `json:"orgRoles"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// Organizations holds the dependencies of the '/admin/orgs' and '/orgs/me' endpoints.
+type Organizations struct {
+	DataStore *data.DataStore
+	Orgs      *data.OrganizationStore
+	Roles     *data.RoleStore
+}
+
+// Admin handles the requests of the PASSER staff on the organizations. It is used with the Authenticate and RequirePermission middlewares.
+// - 'GET /admin/orgs' lists the organizations;
+// - 'GET /admin/orgs/{id}' gets an organization, with its memberships;
+// - 'POST /admin/orgs' adds an organization, owned by an existing user.
+func (o *Organizations) Admin(w http.ResponseWriter, r *http.Request) {
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/orgs"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: organizations", o.Orgs.ListAll())
+	case r.Method == http.MethodGet:
+		org, err := o.Orgs.Find(id)
+		if err != nil {
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: organization", orgView{Organization: org, Members: o.Orgs.Members(org.Id)})
+	case r.Method == http.MethodPost && id == "":
+		o.add(w, r)
+	default:
+		msg := fmt.Sprintf("[Organizations]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// Mine handles the 'GET /orgs/me' request, i.e. gets the organization of the authenticated user.
+// It is used with the Authenticate middleware.
+func (o *Organizations) Mine(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		msg := fmt.Sprintf("[Organizations]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+		return
+	}
+
+	org, ok := o.orgOf(w, r)
+	if !ok {
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: organization", org)
+}
+
+// Members handles the requests of a merchant owner on the user accounts of the own organization, i.e. the organization of the token ('org' claim).
+// It is used with the Authenticate and RequirePermission middlewares.
+// - 'GET /orgs/me/users' lists the user accounts of the organization;
+// - 'GET /orgs/me/users/{email}' gets a user account of the organization;
+// - 'POST /orgs/me/users' adds a user account to the organization;
+// - 'PUT /orgs/me/users/{email}' updates the name, status and roles (within the organization) of a user account of the organization;
+// - 'DELETE /orgs/me/users/{email}' removes a user account of the organization.
+// The users outside of the organization are reported as not found. The account of the owner cannot be updated or removed.
+func (o *Organizations) Members(w http.ResponseWriter, r *http.Request) {
+
+	org, ok := o.orgOf(w, r)
+	if !ok {
+		return
+	}
+
+	email := strings.ToLower(strings.Trim(strings.TrimPrefix(r.URL.Path, "/orgs/me/users"), "/"))
+
+	switch {
+	case r.Method == http.MethodGet && email == "":
+		members := []memberView{}
+		for _, m := range o.Orgs.Members(org.Id) {
+			if v, err := o.member(r.Context(), org, m.UserId); err == nil {
+				members = append(members, v)
+			}
+		}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: user accounts of the organization", members)
+	case r.Method == http.MethodGet:
+		v, err := o.member(r.Context(), org, email)
+		if err != nil {
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: user account of the organization", v)
+	case r.Method == http.MethodPost && email == "":
+		o.addMember(w, r, org)
+	case r.Method == http.MethodPut && email != "":
+		o.updateMember(w, r, org, email)
+	case r.Method == http.MethodDelete && email != "":
+		o.removeMember(w, r, org, email)
+	default:
+		msg := fmt.Sprintf("[Organizations]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// add handles the request to add an organization. The owner joins it as MERCHANT_OWNER.
+func (o *Organizations) add(w http.ResponseWriter, r *http.Request) {
+
+	var params paramsAddOrg
+	if !readOrgParams(w, r, &params) {
+		return
+	}
+
+	params.Id = strings.TrimSpace(params.Id)
+	params.OwnerEmail = strings.ToLower(strings.TrimSpace(params.OwnerEmail))
+	if !orgIdPattern.MatchString(params.Id) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "id is a required attribute, in lower case (e.g. bestbuy)", nil)
+		return
+	}
+	if isEmptyString(params.Name) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name is a required attribute", nil)
+		return
+	}
+	if isEmptyString(params.OwnerEmail) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "ownerEmail is a required attribute", nil)
+		return
+	}
+	if !existed(r.Context(), o.DataStore, params.OwnerEmail) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Organizations]: owner not found", nil)
+		return
+	}
+	if _, err := o.Orgs.MembershipOf(params.OwnerEmail); err == nil {
+		helpers.WriteJSON(w, http.StatusConflict, false, data.ErrAlreadyMember.Error(), nil)
+		return
+	}
+
+	now := time.Now()
+	org := models.Organization{
+		Id:        params.Id,
+		Name:      strings.TrimSpace(params.Name),
+		Domain:    strings.ToLower(strings.TrimSpace(params.Domain)),
+		OwnerId:   params.OwnerEmail,
+		CreatedAt: now,
+	}
+
+	err := o.Orgs.Insert(org)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusConflict, false, "[Organizations]: organization already existed", nil)
+		return
+	}
+
+	err = o.Orgs.Join(models.Membership{OrgId: org.Id, UserId: org.OwnerId, Roles: []string{models.RoleMerchantOwner}, JoinedAt: now})
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionOrgCreate, org.Id, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Organizations]: organization added successfully", orgView{Organization: org, Members: o.Orgs.Members(org.Id)})
+}
+
+// addMember handles the request to add a user account to the organization.
+func (o *Organizations) addMember(w http.ResponseWriter, r *http.Request, org models.Organization) {
+
+	var params paramsAddMember
+	if !readOrgParams(w, r, &params) {
+		return
+	}
+
+	params.Email = strings.ToLower(strings.TrimSpace(params.Email))
+	if isEmptyString(params.Email) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "email is a required attribute", nil)
+		return
+	}
+	if !isValidRegistrationEmail(params.Email) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "email is not a valid format", nil)
+		return
+	}
+	if isEmptyString(params.Name.First) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name.first is a required attribute", nil)
+		return
+	}
+	if isEmptyString(params.Name.Last) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name.last is a required attribute", nil)
+		return
+	}
+	if len(params.Password) < minPasswordLength {
+		msg := fmt.Sprintf("password must have at least %d characters", minPasswordLength)
+		helpers.WriteJSON(w, http.StatusBadRequest, false, msg, nil)
+		return
+	}
+
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	if msg, ok := o.checkGrantable(pl, params.Roles); !ok {
+		middlewares.Audit(r, audit.ActionMemberCreate, params.Email, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, msg, nil)
+		return
+	}
+
+	if existed(r.Context(), o.DataStore, params.Email) {
+		helpers.WriteJSON(w, http.StatusConflict, false, ErrUserExisted.Error(), nil)
+		return
+	}
+
+	start := time.Now()
+	pwhash, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.MinCost)
+	metrics.BcryptDuration.ObserveSince(start, "hash")
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Organizations]: fail to add user", nil)
+		return
+	}
+
+	// the permissions of the account come from its roles within the organization only.
+	u := models.User{
+		Id:       params.Email,
+		Email:    params.Email,
+		PwHash:   string(pwhash),
+		Name:     models.Name{First: strings.TrimSpace(params.Name.First), Last: strings.TrimSpace(params.Name.Last)},
+		IsActive: params.IsActive,
+		Roles:    []string{},
+	}
+
+	err = o.DataStore.InsertNodeContext(r.Context(), u, u.Email)
+	if err != nil {
+		middlewares.Audit(r, audit.ActionMemberCreate, u.Id, audit.OutcomeFailure)
+		helpers.WriteJSON(w, http.StatusConflict, false, ErrUserExisted.Error(), nil)
+		return
+	}
+
+	err = o.Orgs.Join(models.Membership{OrgId: org.Id, UserId: u.Id, Roles: params.Roles, JoinedAt: time.Now()})
+	if err != nil {
+		o.DataStore.RemoveContext(r.Context(), u.Id)
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Organizations]: fail to add user", nil)
+		return
+	}
+
+	v, _ := o.member(r.Context(), org, u.Id)
+	middlewares.Audit(r, audit.ActionMemberCreate, u.Id, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Organizations]: user added successfully", v)
+}
+
+// updateMember handles the request to update a user account of the organization.
+func (o *Organizations) updateMember(w http.ResponseWriter, r *http.Request, org models.Organization, email string) {
+
+	current, err := o.member(r.Context(), org, email)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+		return
+	}
+	if current.Id == org.OwnerId {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Organizations]: the owner of the organization cannot be updated", nil)
+		return
+	}
+
+	var params paramsUpdateMember
+	if !readOrgParams(w, r, &params) {
+		return
+	}
+
+	if isEmptyString(params.Name.First) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name.first is a required attribute", nil)
+		return
+	}
+	if isEmptyString(params.Name.Last) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name.last is a required attribute", nil)
+		return
+	}
+
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	if msg, ok := o.checkGrantable(pl, params.Roles); !ok {
+		middlewares.Audit(r, audit.ActionMemberUpdate, current.Id, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, msg, nil)
+		return
+	}
+
+	u := current.User
+	u.Name = models.Name{First: strings.TrimSpace(params.Name.First), Last: strings.TrimSpace(params.Name.Last)}
+	u.IsActive = params.IsActive
+
+	_, err = o.DataStore.UpdateContext(r.Context(), u.Id, u)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Organizations]: user not found", nil)
+		return
+	}
+	_, err = o.Orgs.Update(u.Id, params.Roles)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+		return
+	}
+
+	v, _ := o.member(r.Context(), org, u.Id)
+	middlewares.Audit(r, audit.ActionMemberUpdate, u.Id, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: user updated successfully", v)
+}
+
+// removeMember handles the request to remove a user account of the organization.
+func (o *Organizations) removeMember(w http.ResponseWriter, r *http.Request, org models.Organization, email string) {
+
+	current, err := o.member(r.Context(), org, email)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+		return
+	}
+	if current.Id == org.OwnerId {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Organizations]: the owner of the organization cannot be removed", nil)
+		return
+	}
+
+	o.Orgs.Leave(current.Id)
+	err = o.DataStore.RemoveContext(r.Context(), current.Id)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Organizations]: user not found", nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionMemberDelete, current.Id, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusOK, true, "[Organizations]: user removed successfully", nil)
+}
+
+// orgOf returns the organization of the token ('org' claim).
+// A token without an organization (e.g. of a consumer) or of a client is refused.
+func (o *Organizations) orgOf(w http.ResponseWriter, r *http.Request) (models.Organization, bool) {
+
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || pl.Org == "" {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Organizations]: user is not a member of any organization", nil)
+		return models.Organization{}, false
+	}
+
+	org, err := o.Orgs.Find(pl.Org)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusForbidden, false, err.Error(), nil)
+		return models.Organization{}, false
+	}
+
+	return org, true
+}
+
+// member returns the user account with the email, when the user is a member of the organization.
+func (o *Organizations) member(ctx context.Context, org models.Organization, email string) (memberView, error) {
+
+	m, err := o.Orgs.MembershipOf(email)
+	if err != nil || m.OrgId != org.Id {
+		return memberView{}, errors.New("[Organizations]: user not found in the organization")
+	}
+
+	found, err := o.DataStore.FindContext(ctx, email)
+	if err != nil {
+		return memberView{}, errors.New("[Organizations]: user not found in the organization")
+	}
+
+	return memberView{User: found.GetItem().(models.User), OrgRoles: m.Roles, JoinedAt: m.JoinedAt}, nil
+}
+
+// checkGrantable checks that the roles exist, and that each grants only the permissions the caller holds,
+// so an owner can never grant more than the owner has.
+func (o *Organizations) checkGrantable(pl jwt.JWTPayload, roles []string) (string, bool) {
+
+	if !areValidRoles(roles, o.Roles) {
+		return "roles must contain valid values", false
+	}
+
+	for _, role := range roles {
+		if _, ok := holdsAll(pl, o.Roles.Permissions([]string{role})); !ok {
+			return fmt.Sprintf("[Organizations]: role '%s' grants more than the permissions of the caller", role), false
+		}
+	}
+
+	return "", true
+}
+
+// readOrgParams reads the json request body into params.
+func readOrgParams(w http.ResponseWriter, r *http.Request, params interface{}) bool {
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		helpers.WriteJSON(w, http.StatusUnsupportedMediaType, false, "[Organizations]: request body must be json", nil)
+		return false
+	}
+
+	err := json.Unmarshal(getBody(&w, r), params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Organizations]: request body is not a valid json", nil)
+		return false
+	}
+
+	return true
+}
@@ -1,20 +1,21 @@
 package users
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/go-qiu/passer-auth-service/audit"
 	"github.com/go-qiu/passer-auth-service/data"
 	"github.com/go-qiu/passer-auth-service/data/models"
 	"github.com/go-qiu/passer-auth-service/data/stack"
-	"github.com/go-qiu/passer-auth-service/jwt"
-	"github.com/joho/godotenv"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -38,9 +39,9 @@ func getAll(w *http.ResponseWriter, r *http.Request, ds *data.DataStore) {
 	// instantiate a stack to cache the nodes
 	accounts := stack.New()
 
-	err := ds.ListAllNodes(&accounts, false)
+	err := ds.ListAllNodesContext(r.Context(), &accounts, false)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("[Users]: fail to list the users", logging.FieldError, err)
 		http.Error(*w, err.Error(), http.StatusInternalServerError)
 	}
 
@@ -52,7 +53,7 @@ func getAll(w *http.ResponseWriter, r *http.Request, ds *data.DataStore) {
 		user, _ := accounts.Pop()
 		c, err := user.(models.User).ToJson(false)
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("[Users]: fail to encode a user", logging.FieldError, err)
 			hasFailed = true
 			http.Error(*w, err.Error(), http.StatusInternalServerError)
 			break
@@ -77,76 +78,8 @@ func getAll(w *http.ResponseWriter, r *http.Request, ds *data.DataStore) {
 	}
 }
 
-// execAuth executes the authentication check
-func execAuth(r *http.Request, ds *data.DataStore) (string, error) {
-
-	var params paramsAuth
-	b, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-
-	if err != nil {
-		log.Println(err)
-		return "", err
-	}
-	err = json.Unmarshal(b, &params)
-	if err != nil {
-		log.Println(err)
-		return "", err
-	}
-
-	// (*w).Header().Set("Content-Type", "application/json")
-	found, err := ds.Find(params.Email)
-	if err != nil {
-		return "", ErrAuthFail
-	}
-
-	// found.
-	user := found.GetItem()
-	err = bcrypt.CompareHashAndPassword([]byte(user.(models.User).PwHash), []byte(params.Pw))
-	if err != nil {
-		// pwhash does not match.
-		return "", ErrAuthFail
-	} else {
-		// pwhash matches
-		userJsonString, err := user.(models.User).ToJson(false)
-		if err != nil {
-			return "", err
-		}
-
-		return userJsonString, nil
-	}
-}
-
-// generateJWT will generate a JWT using the header and payload passed in.
-func generateJWT(payload jwt.JWTPayload) (string, error) {
-
-	// get .env values
-	err := godotenv.Load()
-	if err != nil {
-		errString := "[JWT]: fail to load .env"
-		return "", errors.New(errString)
-	}
-	JWT_SECRET_KEY := os.Getenv("JWT_SECRET_KEY")
-
-	// secret key to use "P@ss3r.54321"
-	header := `{
-		"alg": "SHA512",
-		"typ" : "JWT"
-	}`
-
-	// convert payload data to json string
-	pl, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
-	}
-
-	token := jwt.Generate(header, string(pl), JWT_SECRET_KEY)
-
-	return token, nil
-}
-
 // add a user
-func add(ds *data.DataStore, p paramsAdd) (string, error) {
+func add(ctx context.Context, ds *data.DataStore, p paramsAdd) (string, error) {
 
 	var u models.User
 
@@ -157,19 +90,21 @@ func add(ds *data.DataStore, p paramsAdd) (string, error) {
 	u.IsActive = p.IsActive
 	u.Roles = p.Roles
 
+	start := time.Now()
 	pwhash, err := bcrypt.GenerateFromPassword([]byte(p.Password), bcrypt.MinCost)
+	metrics.BcryptDuration.ObserveSince(start, "hash")
 	if err != nil {
 		return "", err
 	}
 	u.PwHash = string(pwhash)
 
-	err = ds.InsertNode(u, u.Email)
+	err = ds.InsertNodeContext(ctx, u, u.Email)
 	if err != nil {
 		return "", err
 	}
 
 	// get the new user added from the in-memory data store
-	n, err := ds.Find(p.Email)
+	n, err := ds.FindContext(ctx, p.Email)
 	if err != nil {
 		return "", err
 	}
@@ -183,7 +118,7 @@ func add(ds *data.DataStore, p paramsAdd) (string, error) {
 }
 
 // update a user
-func update(ds *data.DataStore, p paramsUpdate) (string, error) {
+func update(ctx context.Context, ds *data.DataStore, p paramsUpdate) (string, error) {
 
 	updates := models.User{}
 	updates.Id = p.Email
@@ -193,7 +128,7 @@ func update(ds *data.DataStore, p paramsUpdate) (string, error) {
 	updates.Name.Last = p.Updates.Name.Last
 	updates.Roles = p.Updates.Roles
 
-	updated, err := ds.Update(p.Email, updates)
+	updated, err := ds.UpdateContext(ctx, p.Email, updates)
 	if err != nil {
 		return "{}", err
 	}
@@ -206,9 +141,9 @@ func update(ds *data.DataStore, p paramsUpdate) (string, error) {
 }
 
 // remove a user
-func remove(ds *data.DataStore, email string) error {
+func remove(ctx context.Context, ds *data.DataStore, email string) error {
 
-	err := ds.Remove(email)
+	err := ds.RemoveContext(ctx, email)
 	if err != nil {
 		return err
 	}
@@ -218,8 +153,8 @@ func remove(ds *data.DataStore, email string) error {
 
 // existed checks (by email) if a data point (i.e. user)
 // existed in the in-memory data store.
-func existed(ds *data.DataStore, email string) bool {
-	found, err := ds.Find(email)
+func existed(ctx context.Context, ds *data.DataStore, email string) bool {
+	found, err := ds.FindContext(ctx, email)
 	if err != nil && found == nil {
 		return false
 	}
@@ -253,9 +188,9 @@ func handleGetRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStor
 		// id was passed in via the url
 		(*w).Header().Set("Content-Type", "application/json")
 		// get the user data point that matches the id
-		found, err := ds.Find(params.Get("id"))
+		found, err := ds.FindContext(r.Context(), params.Get("id"))
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(r.Context()).Warn("[Users]: fail to find the user", logging.FieldError, err)
 			http.Error(*w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -270,7 +205,7 @@ func handleGetRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStor
 }
 
 // handlePostRequst handles the post request to add a user
-func handlePostRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStore, body []byte) {
+func handlePostRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStore, roles *data.RoleStore, body []byte) {
 
 	// parse the json content into a struct
 	// for easier handling
@@ -278,6 +213,7 @@ func handlePostRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataSto
 	err := json.Unmarshal(body, &paramsAdd)
 	if err != nil {
 		http.Error(*w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	// ok. struct is ready.
@@ -318,39 +254,66 @@ func handlePostRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataSto
 		return
 	}
 
-	if areValidRoles(paramsAdd.Roles) {
+	if !areValidRoles(paramsAdd.Roles, roles) {
 		http.Error(*w, "roles must contain valid values", http.StatusBadRequest)
 		return
 	}
 
+	// the roles must grant only the permissions the caller holds, e.g. only an admin can add an admin.
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	if perm, ok := holdsAll(pl, roles.Permissions(paramsAdd.Roles)); !ok {
+		middlewares.Audit(r, audit.ActionUserCreate, paramsAdd.Email, audit.OutcomeDenied)
+		http.Error(*w, fmt.Sprintf("roles grant the permission, '%s', which the caller does not hold", perm), http.StatusForbidden)
+		return
+	}
+
 	// check if the user already existed.
-	existed := existed(ds, paramsAdd.Email)
+	existed := existed(r.Context(), ds, paramsAdd.Email)
 	if existed {
 		// user email already existed
+		middlewares.Audit(r, audit.ActionUserCreate, paramsAdd.Email, audit.OutcomeFailure)
 		fmt.Fprintf(*w, `{"ok": false, "msg": "%s", "data": {}}`, ErrUserExisted)
 		return
 	} else {
 		// user email is new
-		new, err := add(ds, paramsAdd)
+		new, err := add(r.Context(), ds, paramsAdd)
 
 		if err != nil {
+			middlewares.Audit(r, audit.ActionUserCreate, paramsAdd.Email, audit.OutcomeFailure)
 			fmt.Fprintln(*w, `{"ok": false, "msg": "fail to add user", "data": {}}`)
+			return
 		}
+		middlewares.Audit(r, audit.ActionUserCreate, paramsAdd.Email, audit.OutcomeSuccess)
 		fmt.Fprintf(*w, `{"ok": true, "msg": "user added successfully", "data": %s}`, new)
 		return
 	}
 }
 
 // handlePutRequest handles the put request to update a user
-func handlePutRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStore, body []byte) {
+func handlePutRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStore, roles *data.RoleStore, body []byte) {
 
 	var paramsUpdate paramsUpdate
 	err := json.Unmarshal(body, &paramsUpdate)
 	if err != nil {
 		http.Error(*w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !isEmptyStringSlice(paramsUpdate.Updates.Roles) && !areValidRoles(paramsUpdate.Updates.Roles, roles) {
+		http.Error(*w, "roles must contain valid values", http.StatusBadRequest)
+		return
+	}
+
+	// the roles must grant only the permissions the caller holds, e.g. only an admin can make a user an admin.
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	if perm, ok := holdsAll(pl, roles.Permissions(paramsUpdate.Updates.Roles)); !ok {
+		middlewares.Audit(r, audit.ActionUserUpdate, paramsUpdate.Email, audit.OutcomeDenied)
+		http.Error(*w, fmt.Sprintf("roles grant the permission, '%s', which the caller does not hold", perm), http.StatusForbidden)
+		return
 	}
-	updated, err := update(ds, paramsUpdate)
+	updated, err := update(r.Context(), ds, paramsUpdate)
 	if err != nil {
+		middlewares.Audit(r, audit.ActionUserUpdate, paramsUpdate.Email, audit.OutcomeFailure)
 		rtn := `{
 			"ok": false,
 			"msg": "fail to find user data to update",
@@ -361,6 +324,7 @@ func handlePutRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataStor
 	}
 
 	// update successfully.
+	middlewares.Audit(r, audit.ActionUserUpdate, paramsUpdate.Email, audit.OutcomeSuccess)
 	fmt.Fprintf(*w, `{
 		"ok": true,
 		"msg": "successfully updated user data",
@@ -377,9 +341,11 @@ func handleDeleteRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataS
 	err := json.Unmarshal(body, &paramsRemove)
 	if err != nil {
 		http.Error(*w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	err = remove(ds, paramsRemove.Email)
+	err = remove(r.Context(), ds, paramsRemove.Email)
 	if err != nil {
+		middlewares.Audit(r, audit.ActionUserDelete, paramsRemove.Email, audit.OutcomeFailure)
 		rtn := `{
 			"ok" : false,
 			"msg" : "user not found",
@@ -388,6 +354,7 @@ func handleDeleteRequest(w *http.ResponseWriter, r *http.Request, ds *data.DataS
 		fmt.Fprintln(*w, rtn)
 		return
 	}
+	middlewares.Audit(r, audit.ActionUserDelete, paramsRemove.Email, audit.OutcomeSuccess)
 	rtn := `{
 		"ok" : true,
 		"msg" : "user removed successfully",
@@ -402,7 +369,7 @@ func getBody(w *http.ResponseWriter, r *http.Request) []byte {
 	defer r.Body.Close()
 
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Warn("[Users]: fail to read the request body", logging.FieldError, err)
 		http.Error(*w, err.Error(), http.StatusInternalServerError)
 		return nil
 	}
@@ -0,0 +1,261 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/data/stack"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// roleNamePattern is the format of the role names, e.g. "MERCHANT", "LOCKER_OPERATOR".
+var roleNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// paramsRole struct is for holding the 'POST /admin/roles' and 'PUT /admin/roles/{name}' request body content.
+type paramsRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits"`
+}
+
+// roleView is a role with all its permissions, including the inherited ones.
+type roleView struct {
+	models.Role
+	Effective []string `json:"effectivePermissions"`
+}
+
+// Roles holds the dependencies of the '/admin/roles' and '/admin/permissions' endpoints.
+type Roles struct {
+	DataStore *data.DataStore
+	Store     *data.RoleStore
+	Orgs      *data.OrganizationStore
+}
+
+// Permissions lists the permission catalog, i.e. 'GET /admin/permissions'.
+// It is used with the Authenticate and RequirePermission middlewares.
+func (rs *Roles) Permissions(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		msg := fmt.Sprintf("[Roles]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, true, "[Roles]: permission catalog", models.Permissions)
+}
+
+// Handler handles the requests on the roles. It is used with the Authenticate and RequirePermission middlewares.
+// - 'GET /admin/roles' lists the roles;
+// - 'GET /admin/roles/{name}' gets a role;
+// - 'POST /admin/roles' adds a role;
+// - 'PUT /admin/roles/{name}' replaces the description, permissions and inherited roles of a role;
+// - 'DELETE /admin/roles/{name}' removes a role that is not assigned to any user, nor held within any organization.
+// The ADMIN role cannot be updated or removed, and a role can only be given the permissions the caller holds (see grantable).
+// The changes apply to the tokens issued afterwards; the tokens already issued keep their permissions until they expire.
+func (rs *Roles) Handler(w http.ResponseWriter, r *http.Request) {
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/roles"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		views := []roleView{}
+		for _, role := range rs.Store.ListAll() {
+			views = append(views, rs.view(role))
+		}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Roles]: roles", views)
+	case r.Method == http.MethodGet:
+		role, err := rs.Store.Find(name)
+		if err != nil {
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Roles]: role", rs.view(role))
+	case r.Method == http.MethodPost && name == "":
+		rs.add(w, r)
+	case r.Method == http.MethodPut && name != "":
+		rs.update(w, r, name)
+	case r.Method == http.MethodDelete && name != "":
+		rs.remove(w, r, name)
+	default:
+		msg := fmt.Sprintf("[Roles]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// add handles the request to add a role.
+func (rs *Roles) add(w http.ResponseWriter, r *http.Request) {
+
+	params, ok := rs.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !roleNamePattern.MatchString(params.Name) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name is a required attribute, in upper case (e.g. LOCKER_OPERATOR)", nil)
+		return
+	}
+
+	if msg, ok := rs.grantable(r, params); !ok {
+		middlewares.Audit(r, audit.ActionRoleCreate, params.Name, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, msg, nil)
+		return
+	}
+
+	role := models.Role{
+		Name:        params.Name,
+		Description: strings.TrimSpace(params.Description),
+		Permissions: params.Permissions,
+		Inherits:    params.Inherits,
+	}
+
+	err := rs.Store.Insert(role)
+	if errors.Is(err, data.ErrDuplicatedNode) {
+		helpers.WriteJSON(w, http.StatusConflict, false, "[Roles]: role already existed", nil)
+		return
+	}
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionRoleCreate, role.Name, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusCreated, true, "[Roles]: role added successfully", rs.view(role))
+}
+
+// update handles the request to replace the role with the name.
+func (rs *Roles) update(w http.ResponseWriter, r *http.Request, name string) {
+
+	if name == models.RoleAdmin {
+		middlewares.Audit(r, audit.ActionRoleUpdate, name, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Roles]: the ADMIN role cannot be updated", nil)
+		return
+	}
+
+	params, ok := rs.readParams(w, r)
+	if !ok {
+		return
+	}
+
+	if msg, ok := rs.grantable(r, params); !ok {
+		middlewares.Audit(r, audit.ActionRoleUpdate, name, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, msg, nil)
+		return
+	}
+
+	role := models.Role{
+		Name:        name,
+		Description: strings.TrimSpace(params.Description),
+		Permissions: params.Permissions,
+		Inherits:    params.Inherits,
+	}
+
+	err := rs.Store.Update(role)
+	if errors.Is(err, data.ErrRoleNotFound) {
+		helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionRoleUpdate, role.Name, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusOK, true, "[Roles]: role updated successfully", rs.view(role))
+}
+
+// remove handles the request to remove the role with the name.
+func (rs *Roles) remove(w http.ResponseWriter, r *http.Request, name string) {
+
+	if name == models.RoleAdmin {
+		middlewares.Audit(r, audit.ActionRoleDelete, name, audit.OutcomeDenied)
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Roles]: the ADMIN role cannot be removed", nil)
+		return
+	}
+
+	if _, err := rs.Store.Find(name); err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+		return
+	}
+
+	// a role assigned to a user, or held within an organization, cannot be removed, so the users are never left with an undefined role.
+	if rs.Orgs != nil && rs.Orgs.AssignsRole(name) {
+		helpers.WriteJSON(w, http.StatusConflict, false, "[Roles]: role is assigned to some users", nil)
+		return
+	}
+
+	accounts := stack.New()
+	err := rs.DataStore.ListAllNodesContext(r.Context(), &accounts, false)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusInternalServerError, false, "[Roles]: fail to remove role", nil)
+		return
+	}
+	for accounts.GetSize() > 0 {
+		item, _ := accounts.Pop()
+		if contains(item.(models.User).Roles, name) {
+			helpers.WriteJSON(w, http.StatusConflict, false, "[Roles]: role is assigned to some users", nil)
+			return
+		}
+	}
+
+	err = rs.Store.Remove(name)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+		return
+	}
+
+	middlewares.Audit(r, audit.ActionRoleDelete, name, audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusOK, true, "[Roles]: role removed successfully", nil)
+}
+
+// grantable checks that the role of the params, with the permissions of the roles it inherits,
+// grants only the permissions the caller of the request holds, so a role cannot be used to escalate the caller's own permissions.
+func (rs *Roles) grantable(r *http.Request, params paramsRole) (string, bool) {
+
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	perms := append(append([]string{}, params.Permissions...), rs.Store.Permissions(params.Inherits)...)
+	if perm, ok := holdsAll(pl, perms); !ok {
+		return fmt.Sprintf("[Roles]: the role grants the permission, '%s', which the caller does not hold", perm), false
+	}
+
+	return "", true
+}
+
+// readParams reads the role in the request body.
+func (rs *Roles) readParams(w http.ResponseWriter, r *http.Request) (paramsRole, bool) {
+
+	var params paramsRole
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		helpers.WriteJSON(w, http.StatusUnsupportedMediaType, false, "[Roles]: request body must be json", nil)
+		return params, false
+	}
+
+	err := json.Unmarshal(getBody(&w, r), &params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[Roles]: request body is not a valid json", nil)
+		return params, false
+	}
+
+	if params.Permissions == nil {
+		params.Permissions = []string{}
+	}
+	if params.Inherits == nil {
+		params.Inherits = []string{}
+	}
+
+	return params, true
+}
+
+// view returns the role with all its permissions.
+func (rs *Roles) view(role models.Role) roleView {
+	return roleView{Role: role, Effective: rs.Store.Permissions([]string{role.Name})}
+}
@@ -0,0 +1,237 @@
+package users
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/jwt"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+)
+
+// maxUserAgentLength is the number of characters of the user agent kept with a session.
+const maxUserAgentLength = 256
+
+// sessionView is a session, marked when it is the session of the token of the request.
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// Sessions holds the dependencies of the '/users/me/sessions' and '/admin/users/{email}/sessions' endpoints.
+type Sessions struct {
+	DataStore *data.DataStore
+	Store     *data.SessionStore
+
+	// attributes of the cookies of the cookie sessions (see '/auth?mode=cookie').
+	Cookies middlewares.CookieOptions
+}
+
+// Start records the session of the token issued to the user by '/auth', which expires at exp, from the request.
+// The id of the session is the 'jti' of the token.
+func (ss *Sessions) Start(userId string, r *http.Request, exp time.Time) (models.Session, error) {
+
+	id, err := helpers.NewRandomToken(16)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+	session := models.Session{
+		Id:         id,
+		UserId:     userId,
+		UserAgent:  ua,
+		Device:     deviceOf(ua),
+		IP:         middlewares.ClientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  exp,
+	}
+
+	err = ss.Store.Insert(session)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// IsRevoked checks if the payload is of a token issued by '/auth', or exchanged for one (i.e. with the same 'jti'),
+// whose session has been revoked. Otherwise, it records the activity of the session.
+func (ss *Sessions) IsRevoked(pl jwt.JWTPayload) bool {
+
+	if pl.Jti == "" {
+		return false
+	}
+
+	now := time.Now()
+	session, err := ss.Store.Find(pl.Jti)
+	if err != nil {
+		// a token issued by '/auth' always has a session; it was revoked and removed (see SweepInactive).
+		return isSessionToken(pl)
+	}
+	if !session.IsActive(now) {
+		return true
+	}
+
+	ss.Store.Touch(session.Id, now)
+	return false
+}
+
+// SweepInactive removes the sessions that have been revoked or have expired, every interval.
+// It runs until the program exits.
+func (ss *Sessions) SweepInactive(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		ss.Store.RemoveInactive(now)
+	}
+}
+
+// Logout handles the 'POST /auth/logout' request. It is used with the Authenticate middleware.
+// It revokes the session of the token of the request, and clears the cookies of a cookie session.
+func (ss *Sessions) Logout(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		msg := fmt.Sprintf("[Sessions]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+		return
+	}
+
+	pl, _ := middlewares.PayloadFrom(r.Context())
+	if isSessionToken(pl) {
+		// the session may already have been revoked, e.g. from another device. the user is logged out all the same.
+		ss.Store.Revoke(pl.Jti, pl.Subject(), time.Now())
+	}
+
+	middlewares.ClearSessionCookies(w, ss.Cookies)
+	middlewares.Audit(r, audit.ActionLogout, pl.Subject(), audit.OutcomeSuccess)
+	helpers.WriteJSON(w, http.StatusOK, true, "[Sessions]: logged out", nil)
+}
+
+// Handler handles the requests on the sessions of the authenticated user. It is used with the Authenticate middleware.
+// - 'GET /users/me/sessions' lists the active sessions;
+// - 'DELETE /users/me/sessions/{id}' revokes a session, i.e. logs its device out.
+// The sessions can only be managed with the user's own JWT (see '/auth'), not with an API key, a token issued to an OAuth 2.0 client
+// or a delegated token (e.g. of an impersonating admin).
+func (ss *Sessions) Handler(w http.ResponseWriter, r *http.Request) {
+
+	pl, ok := middlewares.PayloadFrom(r.Context())
+	if !ok || pl.ClientId != "" || pl.Act != nil {
+		helpers.WriteJSON(w, http.StatusForbidden, false, "[Sessions]: sessions can only be managed with the user's own token", nil)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/me/sessions"), "/")
+	ss.serve(w, r, pl, pl.Subject(), id)
+}
+
+// Admin handles the requests of the PASSER staff on the sessions of any user. It is used with the Authenticate and RequirePermission middlewares.
+// - 'GET /admin/users/{email}/sessions' lists the active sessions of the user;
+// - 'DELETE /admin/users/{email}/sessions/{id}' revokes a session of the user.
+func (ss *Sessions) Admin(w http.ResponseWriter, r *http.Request) {
+
+	pl, _ := middlewares.PayloadFrom(r.Context())
+
+	email, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/")
+	id := strings.TrimPrefix(rest, "sessions")
+	if email == "" || !strings.HasPrefix(rest, "sessions") || (id != "" && !strings.HasPrefix(id, "/")) {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Sessions]: not found", nil)
+		return
+	}
+
+	if !existed(r.Context(), ss.DataStore, email) {
+		helpers.WriteJSON(w, http.StatusNotFound, false, "[Sessions]: user not found", nil)
+		return
+	}
+
+	ss.serve(w, r, pl, email, strings.Trim(id, "/"))
+}
+
+// serve lists or revokes the sessions of the user.
+func (ss *Sessions) serve(w http.ResponseWriter, r *http.Request, pl jwt.JWTPayload, userId string, id string) {
+
+	now := time.Now()
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		views := []sessionView{}
+		for _, session := range ss.Store.ListByUser(userId, now) {
+			views = append(views, sessionView{Session: session, Current: isSessionToken(pl) && session.Id == pl.Jti})
+		}
+		helpers.WriteJSON(w, http.StatusOK, true, "[Sessions]: active sessions of the user", views)
+	case r.Method == http.MethodDelete && id != "":
+		session, err := ss.Store.Revoke(id, userId, now)
+		if err != nil {
+			middlewares.Audit(r, audit.ActionSessionRevoke, userId, audit.OutcomeFailure)
+			helpers.WriteJSON(w, http.StatusNotFound, false, err.Error(), nil)
+			return
+		}
+		middlewares.Audit(r, audit.ActionSessionRevoke, userId, audit.OutcomeSuccess)
+		helpers.WriteJSON(w, http.StatusOK, true, "[Sessions]: session revoked", session)
+	default:
+		msg := fmt.Sprintf("[Sessions]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+	}
+}
+
+// isSessionToken checks if the payload is of a token issued by '/auth', i.e. a first-party token of the user with a 'jti'.
+func isSessionToken(pl jwt.JWTPayload) bool {
+	return pl.ClientId == "" && pl.Act == nil && pl.Jti != ""
+}
+
+// deviceOf returns a short description of the device of the user agent, for the users to recognise their sessions.
+func deviceOf(ua string) string {
+
+	ua = strings.ToLower(ua)
+
+	var platform string
+	switch {
+	case strings.Contains(ua, "iphone"):
+		platform = "iPhone"
+	case strings.Contains(ua, "ipad"):
+		platform = "iPad"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	case ua == "":
+		return "Unknown device"
+	default:
+		platform = "Other"
+	}
+
+	var browser string
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	default:
+		return platform
+	}
+
+	return fmt.Sprintf("%s on %s", browser, platform)
+}
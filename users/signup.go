@@ -0,0 +1,352 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-qiu/passer-auth-service/audit"
+	"github.com/go-qiu/passer-auth-service/data"
+	"github.com/go-qiu/passer-auth-service/data/models"
+	"github.com/go-qiu/passer-auth-service/helpers"
+	"github.com/go-qiu/passer-auth-service/logging"
+	"github.com/go-qiu/passer-auth-service/mailer"
+	"github.com/go-qiu/passer-auth-service/metrics"
+	"github.com/go-qiu/passer-auth-service/middlewares"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the minimum number of characters of a self-registered password.
+const minPasswordLength = 8
+
+var ErrInvalidVerifyToken error = errors.New("[API-Users]: verification token is invalid or has expired")
+
+// msgSignUpAccepted is sent for every valid sign up request, so that the response does not reveal whether the email is registered.
+const msgSignUpAccepted = "[API-Users]: sign up accepted. check your email to activate the account"
+
+// paramsSignUp struct is for holding the '/signup' request body content.
+type paramsSignUp struct {
+	Email        string `json:"email"`
+	Name         name   `json:"name"`
+	Password     string `json:"password"`
+	Confirmation string `json:"confirmation"`
+}
+
+// paramsVerify struct is for holding the '/signup/verify' request body content.
+type paramsVerify struct {
+	Token string `json:"token"`
+}
+
+// Registration holds the dependencies of the public self-registration endpoints.
+type Registration struct {
+	DataStore *data.DataStore
+	Tokens    *data.TokenStore
+	Mailer    mailer.Mailer
+	VerifyURL string
+	TokenTTL  time.Duration
+}
+
+// SignUp handles the 'POST' request to self-register a CONSUMER account.
+// The account is created as inactive and is only activated when the link mailed to the email is confirmed (see Verify).
+// A valid request is answered with 202 whether or not the email is registered (see register).
+func (reg *Registration) SignUp(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		msg := fmt.Sprintf("[API-Users]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		helpers.WriteJSON(w, http.StatusUnsupportedMediaType, false, "[API-Users]: request body must be json", nil)
+		return
+	}
+
+	var params paramsSignUp
+	err := json.Unmarshal(getBody(&w, r), &params)
+	if err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "[API-Users]: request body is not a valid json", nil)
+		return
+	}
+
+	// exceptions handling
+	params.Email = strings.ToLower(strings.TrimSpace(params.Email))
+	if isEmptyString(params.Email) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "email is a required attribute", nil)
+		return
+	}
+	if !isValidRegistrationEmail(params.Email) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "email is not a valid format", nil)
+		return
+	}
+	if isEmptyString(params.Name.First) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name.first is a required attribute", nil)
+		return
+	}
+	if isEmptyString(params.Name.Last) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "name.last is a required attribute", nil)
+		return
+	}
+	if len(params.Password) < minPasswordLength {
+		msg := fmt.Sprintf("password must have at least %d characters", minPasswordLength)
+		helpers.WriteJSON(w, http.StatusBadRequest, false, msg, nil)
+		return
+	}
+	if params.Confirmation != params.Password {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "password and confirmation are not the same", nil)
+		return
+	}
+
+	// the registration is done in the background, and the same response is sent whether or not the email is registered,
+	// so neither the response nor its time reveals the registered emails.
+	// it outlives the request, whose context is cancelled once it is served, so it keeps the values of the context only.
+	logger := logging.FromContext(r.Context())
+	detached := r.WithContext(context.WithoutCancel(r.Context()))
+	go func(p paramsSignUp) {
+		err := reg.register(detached, p)
+		if err != nil {
+			logger.Error("[API-Users]: fail to sign up", logging.FieldError, err)
+		}
+	}(params)
+
+	helpers.WriteJSON(w, http.StatusAccepted, true, msgSignUpAccepted, nil)
+}
+
+// verifyPage is the data of the page confirming the activation of an account.
+type verifyPage struct {
+	Token   string
+	Message string
+}
+
+var verifyTemplate = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>PASSER - Activate your account</title>
+</head>
+<body>
+	<h1>Activate your PASSER account</h1>
+	{{if .Message}}<p role="status">{{.Message}}</p>{{else}}
+	<form method="POST" action="/signup/verify">
+		<input type="hidden" name="token" value="{{.Token}}">
+		<button type="submit">Activate</button>
+	</form>
+	{{end}}
+</body>
+</html>
+`))
+
+// Verify handles the request to confirm the email of a self-registered account and activate it.
+// A 'GET' request (i.e. the mailed link) only renders the page confirming the activation, so the link scanners of the mail servers
+// and the prefetching of the links do not activate the account. The account is activated by the 'POST' request of the page,
+// with the token as a form value, or by a 'POST' request with the token in its json request body.
+func (reg *Registration) Verify(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		if isEmptyString(token) {
+			helpers.WriteJSON(w, http.StatusBadRequest, false, "token is a required attribute", nil)
+			return
+		}
+		renderVerify(w, http.StatusOK, verifyPage{Token: token})
+		return
+	case http.MethodPost:
+	default:
+		msg := fmt.Sprintf("[API-Users]: request method, '%s' is not allowed for this api endpoint", r.Method)
+		helpers.WriteJSON(w, http.StatusMethodNotAllowed, false, msg, nil)
+		return
+	}
+
+	fromPage := r.Header.Get("Content-Type") != "application/json"
+	var token string
+	if fromPage {
+		token = r.PostFormValue("token")
+	} else {
+		var params paramsVerify
+		err := json.Unmarshal(getBody(&w, r), &params)
+		if err == nil {
+			token = params.Token
+		}
+	}
+
+	if isEmptyString(token) {
+		helpers.WriteJSON(w, http.StatusBadRequest, false, "token is a required attribute", nil)
+		return
+	}
+
+	u, err := reg.verify(r.Context(), token)
+	if err != nil {
+		middlewares.AuditAs(r, "", audit.ActionVerifyEmail, "", audit.OutcomeFailure)
+		if fromPage {
+			renderVerify(w, http.StatusBadRequest, verifyPage{Message: "The link is invalid or has expired. Sign up again to receive a new link."})
+			return
+		}
+		helpers.WriteJSON(w, http.StatusBadRequest, false, ErrInvalidVerifyToken.Error(), nil)
+		return
+	}
+
+	middlewares.AuditAs(r, u.Id, audit.ActionVerifyEmail, u.Id, audit.OutcomeSuccess)
+	if fromPage {
+		renderVerify(w, http.StatusOK, verifyPage{Message: "Your account is activated. You can now sign in."})
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, true, "[API-Users]: account is activated", u)
+}
+
+// renderVerify renders the page confirming the activation of an account.
+func renderVerify(w http.ResponseWriter, status int, page verifyPage) {
+
+	// the page must not be framed by another site (i.e. clickjacking) or cached.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	verifyTemplate.Execute(w, page)
+}
+
+// register registers the email of the sign up request, p, and records the outcome in the audit log.
+//   - a new email gets a pending account, and the verification link;
+//   - the email of a pending account (i.e. never verified, e.g. its link has expired, or squatted by another person) gets a new pending account,
+//     replacing the former one, and a new verification link, so an email cannot be blocked by a pending account;
+//   - the email of any other account gets a notice, and the account is left untouched.
+func (reg *Registration) register(r *http.Request, p paramsSignUp) error {
+
+	ctx := r.Context()
+
+	found, err := reg.DataStore.FindContext(ctx, p.Email)
+	if err == nil {
+		current := found.GetItem().(models.User)
+		if !current.PendingVerification || current.IsActive {
+			middlewares.AuditAs(r, p.Email, audit.ActionSignUp, current.Id, audit.OutcomeDenied)
+			return reg.notifyRegistered(current)
+		}
+
+		// the links mailed for the former pending account are no longer valid.
+		reg.Tokens.RemoveAll(current.Id, models.PurposeEmailVerification)
+		err = reg.DataStore.RemoveContext(ctx, current.Email)
+		if err != nil {
+			middlewares.AuditAs(r, p.Email, audit.ActionSignUp, p.Email, audit.OutcomeFailure)
+			return err
+		}
+	}
+
+	u, err := reg.signUp(ctx, p)
+	if err != nil {
+		middlewares.AuditAs(r, p.Email, audit.ActionSignUp, p.Email, audit.OutcomeFailure)
+		return err
+	}
+
+	middlewares.AuditAs(r, u.Id, audit.ActionSignUp, u.Id, audit.OutcomeSuccess)
+	return nil
+}
+
+// notifyRegistered mails the user that a sign up was requested with the email of the account.
+func (reg *Registration) notifyRegistered(u models.User) error {
+
+	body := fmt.Sprintf("Hi %s,\n\n", u.Name.First)
+	body += "Someone tried to sign up for a PASSER account with your email, which already has an account.\n"
+	body += "If it was you, sign in with your password, or use the forgot password page to set a new one.\n"
+	body += "If it was not you, you can ignore this email.\n"
+
+	return reg.Mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "Your PASSER account",
+		Body:    body,
+	})
+}
+
+// signUp adds the pending (i.e. inactive) user and mails the verification link to the user.
+// The email must not be registered (see register).
+func (reg *Registration) signUp(ctx context.Context, p paramsSignUp) (models.User, error) {
+
+	start := time.Now()
+	pwhash, err := bcrypt.GenerateFromPassword([]byte(p.Password), bcrypt.MinCost)
+	metrics.BcryptDuration.ObserveSince(start, "hash")
+	if err != nil {
+		return models.User{}, err
+	}
+
+	u := models.User{
+		Id:       p.Email,
+		Email:    p.Email,
+		PwHash:   string(pwhash),
+		Name:     models.Name{First: strings.TrimSpace(p.Name.First), Last: strings.TrimSpace(p.Name.Last)},
+		IsActive: false,
+		Roles:    []string{"CONSUMER"},
+
+		PendingVerification: true,
+	}
+
+	err = reg.DataStore.InsertNodeContext(ctx, u, u.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	raw, err := helpers.NewRandomToken(32)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = reg.Tokens.Insert(models.Token{
+		Hash:      helpers.HashToken(raw),
+		Purpose:   models.PurposeEmailVerification,
+		UserId:    u.Id,
+		ExpiresAt: time.Now().Add(reg.TokenTTL),
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n", u.Name.First)
+	body += "Thank you for signing up for a PASSER account.\n"
+	body += "Use the link below to confirm your email and activate the account:\n\n"
+	body += fmt.Sprintf("%s%s\n\n", reg.VerifyURL, raw)
+	body += "If you did not sign up, you can ignore this email.\n"
+
+	err = reg.Mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "Activate your PASSER account",
+		Body:    body,
+	})
+	if err != nil {
+		// the account cannot be activated without the link.
+		reg.DataStore.RemoveContext(ctx, u.Email)
+		reg.Tokens.RemoveAll(u.Id, models.PurposeEmailVerification)
+		return models.User{}, err
+	}
+
+	return u, nil
+}
+
+// verify consumes the verification token and activates the user it was issued to.
+func (reg *Registration) verify(ctx context.Context, token string) (models.User, error) {
+
+	t, err := reg.Tokens.Consume(helpers.HashToken(token), models.PurposeEmailVerification)
+	if err != nil {
+		return models.User{}, ErrInvalidVerifyToken
+	}
+
+	found, err := reg.DataStore.FindContext(ctx, t.UserId)
+	if err != nil {
+		return models.User{}, ErrInvalidVerifyToken
+	}
+
+	u := found.GetItem().(models.User)
+	u.IsActive = true
+	u.PendingVerification = false
+
+	_, err = reg.DataStore.UpdateContext(ctx, u.Email, u)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return u, nil
+}